@@ -4,11 +4,16 @@ import (
 	"context"
 	"errors"
 
+	"github.com/alextanhongpin/dbtx/unitofwork"
 	"github.com/uptrace/bun"
 )
 
 var (
-	ErrNonTransaction = errors.New("dbtx: underlying type is not a transaction")
+	// ErrNotTransaction is the same error as dbtx.ErrNotTransaction.
+	ErrNotTransaction = unitofwork.ErrNotTransaction
+
+	// Deprecated: Use ErrNotTransaction instead.
+	ErrNonTransaction = ErrNotTransaction
 	ErrIsTransaction  = errors.New("dbtx: underlying type is transaction")
 )
 
@@ -52,19 +57,28 @@ func (a *Atomic) DBTx(ctx context.Context) DBTX {
 func (a *Atomic) Tx(ctx context.Context) DBTX {
 	tx, ok := Value(ctx)
 	if !ok {
-		panic(ErrNonTransaction)
+		panic(ErrNotTransaction)
 	}
 
 	return tx
 }
 
+// RunInTx wraps the operation in a transaction.
+// If the context already contains a transaction, a savepoint is created
+// instead, and Tx and DBTx resolve to the innermost savepoint. When fn returns
+// an error or panics, only the changes since the savepoint are rolled back,
+// and the error is returned to the parent, which can still commit the
+// transaction.
+// The transaction options from the context are only applied to the parent
+// transaction, since they cannot be changed for savepoints.
 func (a *Atomic) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
-	_, ok := value(ctx)
-	if ok {
-		return fn(ctx)
+	if t, ok := value(ctx); ok {
+		return t.tx.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			return fn(withValue(ctx, &Tx{tx: &tx, fns: a.fns}))
+		})
 	}
 
-	return a.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+	return a.db.RunInTx(ctx, TxOptions(ctx), func(ctx context.Context, tx bun.Tx) error {
 		ctx = withValue(ctx, &Tx{tx: &tx, fns: a.fns})
 
 		return fn(ctx)
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/alextanhongpin/core/storage/pg/pgtest"
+	"github.com/alextanhongpin/dbtx"
 	"github.com/alextanhongpin/dbtx/buntx"
 	_ "github.com/lib/pq"
 )
@@ -15,7 +16,7 @@ import (
 const postgresVersion = "postgres:15.1-alpine"
 
 func TestMain(m *testing.M) {
-	stop := pgtest.InitDB(pgtest.Image(postgresVersion), pgtest.Hook(migrate))
+	stop := pgtest.Init(pgtest.Image(postgresVersion), pgtest.Hook(migrate))
 	code := m.Run()
 	stop() // os.Exit does not care about defer.
 	os.Exit(code)
@@ -70,3 +71,96 @@ func migrate(db *sql.DB) error {
 )`)
 	return err
 }
+
+func TestTxOptions(t *testing.T) {
+	bunDB := pgtest.BunDB(t)
+	u := buntx.New(bunDB)
+	ctx := buntx.WithTxOptions(context.Background(), &sql.TxOptions{
+		ReadOnly:  true,
+		Isolation: sql.LevelSerializable,
+	})
+
+	err := u.RunInTx(ctx, func(ctx context.Context) error {
+		var level string
+		if err := u.Tx(ctx).NewRaw(`show transaction_isolation`).Scan(ctx, &level); err != nil {
+			return err
+		}
+		if level != "serializable" {
+			t.Fatalf("isolation level: want %s, got %s", "serializable", level)
+		}
+
+		_, err := u.Tx(ctx).NewRaw(`insert into users(name) values (?)`, "jane").Exec(ctx)
+		return err
+	})
+	if err == nil {
+		t.Fatal("want error when writing in read-only transaction")
+	}
+}
+
+func TestTxOptionsNil(t *testing.T) {
+	ctx := buntx.WithTxOptions(context.Background(), nil)
+	if opts := buntx.TxOptions(ctx); *opts != (sql.TxOptions{}) {
+		t.Fatalf("tx options: want zero value, got %+v", opts)
+	}
+}
+
+func TestNestedRunInTx(t *testing.T) {
+	bunDB := pgtest.BunDB(t)
+	u := buntx.New(bunDB)
+	ctx := context.Background()
+	t.Cleanup(func() {
+		_, err := bunDB.NewRaw(`delete from users`).Exec(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	errRollback := errors.New("rollback")
+	err := u.RunInTx(ctx, func(ctx context.Context) error {
+		_, err := u.Tx(ctx).NewRaw(`insert into users(name) values (?)`, "alice").Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		// The inner transaction is a savepoint, which is rolled back without
+		// aborting the outer transaction.
+		err = u.RunInTx(ctx, func(ctx context.Context) error {
+			_, err := u.Tx(ctx).NewRaw(`insert into users(name) values (?)`, "bob").Exec(ctx)
+			if err != nil {
+				return err
+			}
+
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			t.Fatalf("want %v, got %v", errRollback, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	err = bunDB.NewRaw(`select name from users order by id`).Scan(ctx, &names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "alice" {
+		t.Fatalf("names: want %v, got %v", []string{"alice"}, names)
+	}
+}
+
+func TestErrNotTransaction(t *testing.T) {
+	u := buntx.New(pgtest.BunDB(t))
+
+	defer func() {
+		err, _ := recover().(error)
+		if !errors.Is(err, dbtx.ErrNotTransaction) {
+			t.Fatalf("want %v, got %v", dbtx.ErrNotTransaction, err)
+		}
+	}()
+
+	u.Tx(context.Background())
+}
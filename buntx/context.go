@@ -2,12 +2,50 @@ package buntx
 
 import (
 	"context"
+	"database/sql"
 )
 
 type ctxKey string
 
-// txCtxKey represents the key for the context containing the pointer of Atomic.
-var txCtxKey = ctxKey("tx")
+var (
+	// txCtxKey represents the key for the context containing the pointer of Atomic.
+	txCtxKey  = ctxKey("tx")
+	roCtxKey  = ctxKey("ro")
+	isoCtxKey = ctxKey("iso")
+)
+
+// WithTxOptions sets the transaction options in the context.
+// A nil opts sets the default options, as in sql.DB.BeginTx.
+func WithTxOptions(ctx context.Context, opts *sql.TxOptions) context.Context {
+	if opts == nil {
+		opts = new(sql.TxOptions)
+	}
+
+	ctx = ReadOnly(ctx, opts.ReadOnly)
+	ctx = IsolationLevel(ctx, opts.Isolation)
+
+	return ctx
+}
+
+// ReadOnly sets the read-only transaction option in the context.
+func ReadOnly(ctx context.Context, readOnly bool) context.Context {
+	return context.WithValue(ctx, roCtxKey, readOnly)
+}
+
+// IsolationLevel sets the transaction isolation level in the context.
+func IsolationLevel(ctx context.Context, isoLevel sql.IsolationLevel) context.Context {
+	return context.WithValue(ctx, isoCtxKey, isoLevel)
+}
+
+// TxOptions returns the *sql.TxOptions from the context.
+func TxOptions(ctx context.Context) *sql.TxOptions {
+	readOnly, _ := ctx.Value(roCtxKey).(bool)
+	isolation, _ := ctx.Value(isoCtxKey).(sql.IsolationLevel)
+	return &sql.TxOptions{
+		ReadOnly:  readOnly,
+		Isolation: isolation,
+	}
+}
 
 func Value(ctx context.Context) (DBTX, bool) {
 	tx, ok := value(ctx)
@@ -0,0 +1,94 @@
+package dbtx
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// WithSQLComment appends the key-value pairs returned by fn as a SQL comment
+// to the queries executed with the context methods, e.g.
+// /*action='create',app='api'*/, following the sqlcommenter format. This
+// allows the slow queries in pg_stat_statements to be correlated with the
+// application.
+// The keys and values are URL encoded, so that they cannot terminate the
+// comment. The queries that already contain a comment are not modified.
+func WithSQLComment(fn func(ctx context.Context) map[string]string) func(DBTX) DBTX {
+	return func(dbtx DBTX) DBTX {
+		return &sqlComment{dbtx: dbtx, fn: fn}
+	}
+}
+
+var _ DBTX = (*sqlComment)(nil)
+
+type sqlComment struct {
+	dbtx DBTX
+	fn   func(ctx context.Context) map[string]string
+}
+
+func (s *sqlComment) Exec(query string, args ...any) (sql.Result, error) {
+	return s.dbtx.Exec(query, args...)
+}
+
+func (s *sqlComment) Prepare(query string) (*sql.Stmt, error) {
+	return s.dbtx.Prepare(query)
+}
+
+func (s *sqlComment) Query(query string, args ...any) (*sql.Rows, error) {
+	return s.dbtx.Query(query, args...)
+}
+
+func (s *sqlComment) QueryRow(query string, args ...any) *sql.Row {
+	return s.dbtx.QueryRow(query, args...)
+}
+
+func (s *sqlComment) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.dbtx.ExecContext(ctx, s.comment(ctx, query), args...)
+}
+
+func (s *sqlComment) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return s.dbtx.PrepareContext(ctx, s.comment(ctx, query))
+}
+
+func (s *sqlComment) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.dbtx.QueryContext(ctx, s.comment(ctx, query), args...)
+}
+
+func (s *sqlComment) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.dbtx.QueryRowContext(ctx, s.comment(ctx, query), args...)
+}
+
+func (s *sqlComment) comment(ctx context.Context, query string) string {
+	if strings.Contains(query, "/*") || strings.Contains(query, "--") {
+		return query
+	}
+
+	kv := s.fn(ctx)
+	if len(kv) == 0 {
+		return query
+	}
+
+	pairs := make([]string, 0, len(kv))
+	for _, k := range slices.Sorted(maps.Keys(kv)) {
+		pairs = append(pairs, escape(k)+"='"+escape(kv[k])+"'")
+	}
+
+	// The comment is placed before the trailing semicolon.
+	query = strings.TrimRight(query, " \t\r\n")
+	query, semicolon := strings.CutSuffix(query, ";")
+	query = query + " /*" + strings.Join(pairs, ",") + "*/"
+	if semicolon {
+		query += ";"
+	}
+
+	return query
+}
+
+// escape URL encodes the value, which also escapes the characters that can
+// terminate the comment or the quote, such as "*/" and "'".
+func escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
@@ -0,0 +1,101 @@
+package dbtx
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/alextanhongpin/dbtx/unitofwork"
+)
+
+// Ensures the struct ConnAtomic implements the interface.
+var (
+	_ atomic                  = (*ConnAtomic)(nil)
+	_ unitofwork.Atomic[DBTX] = (*ConnAtomic)(nil)
+)
+
+// ConnAtomic represents a unit of work that is pinned to a single connection.
+// Use it for operations that are scoped to a session, such as session-level
+// advisory locks, SET, temporary tables and LISTEN/NOTIFY.
+type ConnAtomic struct {
+	conn *sql.Conn
+	*config
+}
+
+// FromConn returns a ConnAtomic that is pinned to the given connection, e.g.
+// a connection that is already used for LISTEN.
+// Unlike Atomic.Conn, the middlewares are not inherited. The caller owns the
+// connection, but Close can be called to return it to the pool.
+func FromConn(conn *sql.Conn, fns ...func(DBTX) DBTX) *ConnAtomic {
+	return &ConnAtomic{
+		conn:   conn,
+		config: &config{fns: fns},
+	}
+}
+
+// DB returns the underlying *sql.Conn as DBTX interface.
+func (c *ConnAtomic) DB() DBTX {
+	return apply(&conn{Conn: c.conn}, c.fns...)
+}
+
+// DBTx returns the *sql.Tx from the context, otherwise the underlying
+// *sql.Conn.
+func (c *ConnAtomic) DBTx(ctx context.Context) DBTX {
+	if tx, ok := Value(ctx); ok {
+		return tx
+	}
+
+	return c.DB()
+}
+
+// Tx returns the *sql.Tx from context.
+// Panics if the context does not contain a transaction.
+func (c *ConnAtomic) Tx(ctx context.Context) DBTX {
+	tx, ok := Value(ctx)
+	if !ok {
+		panic(ErrNotTransaction)
+	}
+
+	return tx
+}
+
+// RunInTx wraps the operation in a transaction that is started on the pinned
+// connection.
+// If the context already contains a transaction, it will be reused instead.
+func (c *ConnAtomic) RunInTx(ctx context.Context, fn func(context.Context) error) error {
+	return c.RunInTxOptions(ctx, nil, fn)
+}
+
+// RunInTxOptions is similar to RunInTx, but begins the transaction with the
+// given options.
+func (c *ConnAtomic) RunInTxOptions(ctx context.Context, opts *sql.TxOptions, fn func(context.Context) error) error {
+	return c.runInTx(ctx, c.conn, opts, fn)
+}
+
+// Close returns the connection to the pool.
+func (c *ConnAtomic) Close() error {
+	return c.conn.Close()
+}
+
+var _ DBTX = (*conn)(nil)
+
+// conn adapts *sql.Conn to the DBTX interface, since it only implements the
+// context methods.
+type conn struct {
+	*sql.Conn
+}
+
+func (c *conn) Exec(query string, args ...any) (sql.Result, error) {
+	return c.ExecContext(context.Background(), query, args...)
+}
+
+func (c *conn) Prepare(query string) (*sql.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) Query(query string, args ...any) (*sql.Rows, error) {
+	return c.QueryContext(context.Background(), query, args...)
+}
+
+func (c *conn) QueryRow(query string, args ...any) *sql.Row {
+	return c.QueryRowContext(context.Background(), query, args...)
+}
@@ -0,0 +1,71 @@
+package dbtx_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alextanhongpin/core/storage/pg/pgtest"
+	"github.com/alextanhongpin/dbtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConn(t *testing.T) {
+	ctx := context.Background()
+	atm := dbtx.New(pgtest.DB(t))
+
+	conn, err := atm.Conn(ctx)
+	is := assert.New(t)
+	is.Nil(err)
+	defer conn.Close()
+
+	// Session-level settings are preserved across queries on the same
+	// connection.
+	_, err = conn.DB().ExecContext(ctx, `set application_name = 'dbtx'`)
+	is.Nil(err)
+
+	var name string
+	err = conn.DBTx(ctx).QueryRowContext(ctx, `show application_name`).Scan(&name)
+	is.Nil(err)
+	is.Equal("dbtx", name)
+
+	err = conn.RunInTx(ctx, func(txCtx context.Context) error {
+		is.True(dbtx.IsTx(txCtx))
+
+		var name string
+		if err := conn.Tx(txCtx).QueryRowContext(txCtx, `show application_name`).Scan(&name); err != nil {
+			return err
+		}
+		is.Equal("dbtx", name)
+
+		return ErrRollback
+	})
+	is.ErrorIs(err, ErrRollback)
+}
+
+func TestFromConn(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.DB(t)
+
+	c, err := db.Conn(ctx)
+	is := assert.New(t)
+	is.Nil(err)
+
+	logger := &InMemoryLogger{}
+	conn := dbtx.FromConn(c, dbtx.WithLogger(logger))
+	defer conn.Close()
+
+	_, err = conn.DB().ExecContext(ctx, `set application_name = 'fromconn'`)
+	is.Nil(err)
+
+	err = conn.RunInTx(ctx, func(txCtx context.Context) error {
+		var name string
+		if err := conn.Tx(txCtx).QueryRowContext(txCtx, `show application_name`).Scan(&name); err != nil {
+			return err
+		}
+		is.Equal("fromconn", name)
+
+		return nil
+	})
+	is.Nil(err)
+	is.Len(logger.Logs, 2)
+}
@@ -13,14 +13,18 @@ var (
 	isoCtxKey = ctxKey("iso")
 )
 
+// ReadOnly sets the read-only transaction option in the context.
 func ReadOnly(ctx context.Context, readOnly bool) context.Context {
 	return context.WithValue(ctx, roCtxKey, readOnly)
 }
 
+// IsolationLevel sets the transaction isolation level in the context.
 func IsolationLevel(ctx context.Context, isoLevel sql.IsolationLevel) context.Context {
 	return context.WithValue(ctx, isoCtxKey, isoLevel)
 }
 
+// TxOptions returns the *sql.TxOptions composed from the options set by
+// ReadOnly and IsolationLevel.
 func TxOptions(ctx context.Context) *sql.TxOptions {
 	readOnly, _ := ctx.Value(roCtxKey).(bool)
 	isolation, _ := ctx.Value(isoCtxKey).(sql.IsolationLevel)
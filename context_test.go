@@ -41,6 +41,17 @@ func TestContext(t *testing.T) {
 		is.True(opt.ReadOnly)
 	})
 
+	t.Run("merge", func(t *testing.T) {
+		ctx := context.Background()
+		ctx = dbtx.ReadOnly(ctx, true)
+		ctx = dbtx.IsolationLevel(ctx, sql.LevelSerializable)
+
+		opt := dbtx.TxOptions(ctx)
+		is := assert.New(t)
+		is.True(opt.ReadOnly)
+		is.Equal(sql.LevelSerializable, opt.Isolation)
+	})
+
 	t.Run("tx", func(t *testing.T) {
 		ctx := context.Background()
 		assert.False(t, dbtx.IsTx(ctx))
@@ -0,0 +1,63 @@
+package dbtx
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+var counterCtxKey = ctxKey("counter")
+
+// CountQueries returns a context with a new query counter, which is
+// incremented by WithQueryCounter for every query made with the context,
+// including those in transactions started from the context.
+func CountQueries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, counterCtxKey, new(counter))
+}
+
+// QueryCount returns the number of queries counted for the context.
+// Returns 0 if the context has no counter.
+func QueryCount(ctx context.Context) int {
+	c, ok := ctx.Value(counterCtxKey).(*counter)
+	if !ok {
+		return 0
+	}
+
+	return c.load()
+}
+
+// WithQueryCounter returns a middleware that counts the queries made with a
+// context from CountQueries, e.g. to detect N+1 queries in tests.
+// Only the context methods are counted, since the other methods have no
+// context. Prepare is not counted, as it does not execute the query.
+func WithQueryCounter() func(DBTX) DBTX {
+	return WithHook(func(ctx context.Context, method, query string, args []any) context.Context {
+		if strings.HasPrefix(method, "Prepare") {
+			return ctx
+		}
+
+		if c, ok := ctx.Value(counterCtxKey).(*counter); ok {
+			c.inc()
+		}
+
+		return ctx
+	}, nil)
+}
+
+type counter struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (c *counter) inc() {
+	c.mu.Lock()
+	c.n++
+	c.mu.Unlock()
+}
+
+func (c *counter) load() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.n
+}
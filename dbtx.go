@@ -4,9 +4,18 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"sync"
+	"time"
+
+	"github.com/alextanhongpin/dbtx/unitofwork"
 )
 
-var ErrNotTransaction = errors.New("dbtx: underlying type is not a transaction")
+var (
+	ErrNotTransaction    = unitofwork.ErrNotTransaction
+	ErrNestedTransaction = errors.New("dbtx: nested transaction")
+	ErrTxAlreadyClosed   = errors.New("dbtx: transaction already closed")
+	ErrTxLeaked          = errors.New("dbtx: transaction leaked")
+)
 
 // DBTX represents the common db operations for both *sql.DB and *sql.Tx.
 type DBTX interface {
@@ -29,20 +38,41 @@ type atomic interface {
 	RunInTx(ctx context.Context, fn func(txCtx context.Context) error) (err error)
 }
 
+// runner represents the minimal interface to run operations in a
+// transaction, which is implemented by all the atomic types.
+type runner interface {
+	RunInTx(ctx context.Context, fn func(txCtx context.Context) error) (err error)
+}
+
 // Ensures the struct Atomic implements the interface.
-var _ atomic = (*Atomic)(nil)
+var (
+	_ atomic                  = (*Atomic)(nil)
+	_ unitofwork.Atomic[DBTX] = (*Atomic)(nil)
+)
 
 // Atomic represents a unit of work.
 type Atomic struct {
-	db  *sql.DB
-	fns []func(DBTX) DBTX
+	db *sql.DB
+	*config
 }
 
 // New returns a pointer to Atomic.
 func New(db *sql.DB, fns ...func(DBTX) DBTX) *Atomic {
+	return NewWithOptions(db, WithMiddleware(fns...))
+}
+
+// NewWithOptions is similar to New, but accepts options that configures the
+// transaction, such as WithTxTimeout. Use WithMiddleware to pass the
+// middlewares.
+func NewWithOptions(db *sql.DB, opts ...Option) *Atomic {
+	cfg := new(config)
+	for _, opt := range opts {
+		opt.apply(cfg)
+	}
+
 	return &Atomic{
-		db:  db,
-		fns: fns,
+		db:     db,
+		config: cfg,
 	}
 }
 
@@ -78,15 +108,91 @@ func (a *Atomic) Tx(ctx context.Context) DBTX {
 	return tx
 }
 
+// Conn returns a ConnAtomic that runs all the operations on a single
+// connection from the pool.
+// The caller must call Close to return the connection to the pool.
+func (a *Atomic) Conn(ctx context.Context) (*ConnAtomic, error) {
+	conn, err := a.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConnAtomic{
+		conn:   conn,
+		config: a.config,
+	}, nil
+}
+
+// CheckLeaks reports the leaked transactions when WithLeakDetection is enabled,
+// e.g. before closing the *sql.DB or at the end of a test.
+// ErrTxLeaked is returned if there are transactions that are still open, or
+// used after RunInTx returns.
+func (a *Atomic) CheckLeaks() error {
+	if a.leaks == nil {
+		return nil
+	}
+
+	return a.leaks.err()
+}
+
 // RunInTx wraps the operation in a transaction. If a context containing tx is
 // passed in, then it will use the context tx. Transaction cannot be nested.
 // The transaction can only be committed by the parent.
 func (a *Atomic) RunInTx(ctx context.Context, fn func(context.Context) error) (err error) {
+	return a.RunInTxOptions(ctx, nil, fn)
+}
+
+// RunInTxOptions is similar to RunInTx, but begins the transaction with the
+// given options instead of the options from the context.
+// If opts is nil, the options from the context is used.
+// The options are ignored if the context already contains a transaction.
+func (a *Atomic) RunInTxOptions(ctx context.Context, opts *sql.TxOptions, fn func(context.Context) error) (err error) {
+	return a.runInTx(ctx, a.db, opts, fn)
+}
+
+// RunInTxResult runs the fn in a transaction and returns the result.
+// The zero value is returned if the transaction is rolled back.
+func RunInTxResult[T any](ctx context.Context, a runner, fn func(context.Context) (T, error)) (T, error) {
+	var res T
+	err := a.RunInTx(ctx, func(txCtx context.Context) error {
+		var err error
+		res, err = fn(txCtx)
+		return err
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return res, nil
+}
+
+// beginner represents the types that can begin a transaction, such as *sql.DB
+// and *sql.Conn.
+type beginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+func (c *config) runInTx(ctx context.Context, db beginner, opts *sql.TxOptions, fn func(context.Context) error) (err error) {
 	if IsTx(ctx) {
+		if c.strictNesting {
+			return ErrNestedTransaction
+		}
+
 		return fn(ctx)
 	}
 
-	tx, err := a.db.BeginTx(ctx, TxOptions(ctx))
+	if opts == nil {
+		opts = TxOptions(ctx)
+	}
+
+	if c.txTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.txTimeout)
+		defer cancel()
+	}
+
+	tx, err := db.BeginTx(ctx, opts)
 	if err != nil {
 		return err
 	}
@@ -101,23 +207,124 @@ func (a *Atomic) RunInTx(ctx context.Context, fn func(context.Context) error) (e
 		}
 	}()
 
-	ctx = withValue(ctx, &Tx{tx: tx, fns: a.fns})
+	t := &Tx{tx: tx, fns: c.fns}
+	if c.stats {
+		t.stats = new(stats)
+		// The stats is applied first, so that only the duration of the
+		// underlying query is measured.
+		t.fns = append([]func(DBTX) DBTX{t.stats.wrap}, t.fns...)
+	}
+	if c.leaks != nil {
+		c.leaks.begin()
+		defer c.leaks.end(t)
+		t.fns = append([]func(DBTX) DBTX{c.leaks.guard(t)}, t.fns...)
+	}
+	ctx = withValue(ctx, t)
 	if err := fn(ctx); err != nil {
-		return errors.Join(tx.Rollback(), err)
+		return errors.Join(tx.Rollback(), contextError(ctx, err))
 	}
 
-	return tx.Commit()
+	if err := t.beforeCommit(ctx); err != nil {
+		return errors.Join(tx.Rollback(), contextError(ctx, err))
+	}
+
+	start := time.Now()
+	if err := tx.Commit(); err != nil {
+		return contextError(ctx, err)
+	}
+	t.stats.commit(time.Since(start))
+
+	t.committed()
+
+	return nil
 }
 
 type Tx struct {
 	tx  *sql.Tx
 	fns []func(DBTX) DBTX
+
+	stats *stats
+
+	mu             sync.Mutex
+	closed         bool
+	onCommit       []func()
+	onBeforeCommit []func(context.Context) error
+	// statementTimeout is the statement_timeout set by WithStatementTimeout,
+	// so that it is only set once per transaction.
+	statementTimeout time.Duration
 }
 
 func (t *Tx) Tx() DBTX {
 	return apply(t.tx, t.fns...)
 }
 
+func (t *Tx) getStatementTimeout() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.statementTimeout
+}
+
+func (t *Tx) setStatementTimeout(d time.Duration) {
+	t.mu.Lock()
+	t.statementTimeout = d
+	t.mu.Unlock()
+}
+
+func (t *Tx) addOnCommit(fn func()) {
+	t.mu.Lock()
+	t.onCommit = append(t.onCommit, fn)
+	t.mu.Unlock()
+}
+
+func (t *Tx) addOnBeforeCommit(fn func(context.Context) error) {
+	t.mu.Lock()
+	t.onBeforeCommit = append(t.onBeforeCommit, fn)
+	t.mu.Unlock()
+}
+
+// beforeCommit invokes the registered OnBeforeCommit callbacks in order, and
+// stops at the first error.
+func (t *Tx) beforeCommit(ctx context.Context) error {
+	// Callbacks may register other callbacks, so the length is checked on
+	// every iteration.
+	for i := 0; ; i++ {
+		t.mu.Lock()
+		if i >= len(t.onBeforeCommit) {
+			t.mu.Unlock()
+			return nil
+		}
+		fn := t.onBeforeCommit[i]
+		t.mu.Unlock()
+
+		if err := fn(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// committed invokes the registered OnCommit callbacks in order.
+func (t *Tx) committed() {
+	t.mu.Lock()
+	fns := t.onCommit
+	t.mu.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// contextError joins the context error with err, since the driver may return
+// a different error when the transaction is cancelled, e.g. when the
+// transaction timeout exceeded.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		return errors.Join(err, ctxErr)
+	}
+
+	return err
+}
+
 func apply(dbtx DBTX, fns ...func(DBTX) DBTX) DBTX {
 	for _, fn := range fns {
 		dbtx = fn(dbtx)
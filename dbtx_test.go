@@ -11,8 +11,9 @@ import (
 
 	"github.com/alextanhongpin/core/storage/pg/pgtest"
 	"github.com/alextanhongpin/dbtx"
+	"github.com/alextanhongpin/dbtx/dbtxmock"
 	"github.com/alextanhongpin/dbtx/postgres/lock"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -59,6 +60,54 @@ func TestLoggerContext(t *testing.T) {
 	t.Log(logger.Logs)
 }
 
+func TestLoggerSlowThreshold(t *testing.T) {
+	logger := &InMemoryLogger{}
+	atm := dbtx.New(pgtest.DB(t), dbtx.WithLogger(logger, dbtx.WithSlowThreshold(50*time.Millisecond)))
+	ctx := context.Background()
+
+	is := assert.New(t)
+	_, err := atm.DB().ExecContext(ctx, "select 1")
+	is.Nil(err)
+	is.Empty(logger.Logs)
+
+	_, err = atm.DB().ExecContext(ctx, "select pg_sleep(0.1)")
+	is.Nil(err)
+	is.Len(logger.Logs, 1)
+	is.Equal("select pg_sleep(0.1)", logger.Logs[0].Query)
+}
+
+func TestLoggerBeforeCall(t *testing.T) {
+	logger := &InMemoryLogger{}
+	db := &dbtxmock.DB{
+		ExecFunc: func(ctx context.Context, query string, args ...any) (sql.Result, error) {
+			panic("hang")
+		},
+	}
+
+	is := assert.New(t)
+	is.Panics(func() {
+		_, _ = dbtx.NewLogger(db, logger).ExecContext(context.Background(), "select 1")
+	})
+	// The query is logged before the call, so that queries that hang or panic
+	// are still logged.
+	is.Len(logger.Logs, 1)
+	is.Equal("select 1", logger.Logs[0].Query)
+}
+
+func TestLoggerRedactor(t *testing.T) {
+	logger := &InMemoryLogger{}
+	atm := dbtx.New(pgtest.DB(t), dbtx.WithLogger(logger, dbtx.WithRedactor(dbtx.RedactAll)))
+
+	var n int
+	err := atm.DB().QueryRowContext(context.Background(), "select 1 + $1", 1).Scan(&n)
+
+	is := assert.New(t)
+	is.Nil(err)
+	is.Equal(2, n)
+	is.Len(logger.Logs, 1)
+	is.Equal([]any{"?"}, logger.Logs[0].Args)
+}
+
 func TestAtomicContext(t *testing.T) {
 	atm := dbtx.New(pgtest.DB(t))
 	ctx := context.Background()
@@ -107,6 +156,275 @@ func TestPanic(t *testing.T) {
 	noRows(t, repo, 42)
 }
 
+func TestRunInTxOptions(t *testing.T) {
+	atm := dbtx.New(pgtest.DB(t))
+	repo := newNumberRepo(atm)
+	ctx := context.Background()
+
+	t.Run("read only", func(t *testing.T) {
+		err := atm.RunInTxOptions(ctx, &sql.TxOptions{ReadOnly: true}, func(txCtx context.Context) error {
+			_, err := repo.Create(txCtx, 20)
+			return err
+		})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("takes precedence over context", func(t *testing.T) {
+		ctx := dbtx.ReadOnly(ctx, true)
+		err := atm.RunInTxOptions(ctx, &sql.TxOptions{}, func(txCtx context.Context) error {
+			insertRow(t, repo, txCtx, 21)
+
+			return ErrRollback
+		})
+		assert.ErrorIs(t, err, ErrRollback)
+	})
+}
+
+func TestTxTimeout(t *testing.T) {
+	atm := dbtx.NewWithOptions(pgtest.DB(t), dbtx.WithTxTimeout(100*time.Millisecond))
+	repo := newNumberRepo(atm)
+
+	err := atm.RunInTx(context.Background(), func(txCtx context.Context) error {
+		insertRow(t, repo, txCtx, 30)
+
+		_, err := atm.Tx(txCtx).ExecContext(txCtx, `select pg_sleep(1)`)
+		return err
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	noRows(t, repo, 30)
+}
+
+func TestStatementTimeout(t *testing.T) {
+	logger := &InMemoryLogger{}
+	atm := dbtx.New(pgtest.DB(t), dbtx.WithLogger(logger), dbtx.WithStatementTimeout(100*time.Millisecond))
+	ctx := context.Background()
+
+	t.Run("tx", func(t *testing.T) {
+		logger.Logs = nil
+
+		is := assert.New(t)
+		err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+			_, err := atm.Tx(txCtx).ExecContext(txCtx, `select pg_sleep(0)`)
+			is.Nil(err)
+
+			_, err = atm.Tx(txCtx).ExecContext(txCtx, `select pg_sleep(1)`)
+			return err
+		})
+		is.ErrorIs(err, dbtx.ErrStatementTimeout)
+
+		// The statement_timeout is only set once per transaction.
+		is.Len(logger.Logs, 3)
+		is.Contains(logger.Logs[0].Query, "set_config")
+		is.Equal(`select pg_sleep(0)`, logger.Logs[1].Query)
+		is.Equal(`select pg_sleep(1)`, logger.Logs[2].Query)
+	})
+
+	t.Run("tx query", func(t *testing.T) {
+		is := assert.New(t)
+		err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+			var n int
+			is.Nil(atm.Tx(txCtx).QueryRowContext(txCtx, `select 1`).Scan(&n))
+			is.Equal(1, n)
+
+			return atm.Tx(txCtx).QueryRowContext(txCtx, `select 1 from pg_sleep(1)`).Scan(&n)
+		})
+		is.True(isStatementTimeout(err), err)
+	})
+
+	t.Run("non-tx", func(t *testing.T) {
+		is := assert.New(t)
+		_, err := atm.DB().ExecContext(ctx, `select pg_sleep(1)`)
+		is.ErrorIs(err, dbtx.ErrStatementTimeout)
+
+		var n int
+		err = atm.DB().QueryRowContext(ctx, `select 1 from pg_sleep(1)`).Scan(&n)
+		is.True(isStatementTimeout(err), err)
+
+		rows, err := atm.DB().QueryContext(ctx, `select pg_sleep(1)`)
+		if err == nil {
+			for rows.Next() {
+			}
+			err = rows.Err()
+			is.Nil(rows.Close())
+		}
+		is.True(isStatementTimeout(err), err)
+	})
+
+	t.Run("non-tx rows", func(t *testing.T) {
+		is := assert.New(t)
+		rows, err := atm.DB().QueryContext(ctx, `select generate_series(1, 3)`)
+		is.Nil(err)
+		defer rows.Close()
+
+		// The rows are from the driver, not buffered in memory.
+		types, err := rows.ColumnTypes()
+		is.Nil(err)
+		is.Equal("INT4", types[0].DatabaseTypeName())
+
+		var got []int
+		for rows.Next() {
+			var n int
+			is.Nil(rows.Scan(&n))
+			got = append(got, n)
+		}
+		is.Nil(rows.Err())
+		is.Equal([]int{1, 2, 3}, got)
+	})
+}
+
+// isStatementTimeout reports whether the err is caused by the statement
+// timeout. The errors returned by Scan and Rows.Err are not wrapped with
+// dbtx.ErrStatementTimeout.
+func isStatementTimeout(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "57014" {
+		return true
+	}
+
+	return errors.Is(err, dbtx.ErrStatementTimeout) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func TestSQLComment(t *testing.T) {
+	logger := &InMemoryLogger{}
+	atm := dbtx.New(pgtest.DB(t),
+		dbtx.WithLogger(logger),
+		dbtx.WithSQLComment(func(ctx context.Context) map[string]string {
+			return map[string]string{
+				"app":    "api",
+				"action": "*/ drop table users; /*",
+			}
+		}),
+	)
+	ctx := context.Background()
+
+	is := assert.New(t)
+	var n int
+	err := atm.DB().QueryRowContext(ctx, "select 1;").Scan(&n)
+	is.Nil(err)
+	is.Equal(1, n)
+
+	err = atm.DB().QueryRow("select 1").Scan(&n)
+	is.Nil(err)
+
+	is.Len(logger.Logs, 2)
+	is.Equal("select 1 /*action='%2A%2F%20drop%20table%20users%3B%20%2F%2A',app='api'*/;", logger.Logs[0].Query)
+	is.Equal("select 1", logger.Logs[1].Query)
+}
+
+func TestMaxRowsAffected(t *testing.T) {
+	atm := dbtx.New(pgtest.DB(t), dbtx.WithMaxRowsAffected(1))
+	repo := newNumberRepo(atm)
+	ctx := context.Background()
+
+	t.Run("tx", func(t *testing.T) {
+		is := assert.New(t)
+		err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+			insertRow(t, repo, txCtx, 40)
+
+			_, err := atm.Tx(txCtx).ExecContext(txCtx, `insert into numbers(n) values (41), (42)`)
+			is.ErrorIs(err, dbtx.ErrTooManyRowsAffected)
+
+			// Ignores the error, the transaction is still rolled back.
+			return nil
+		})
+		is.ErrorIs(err, dbtx.ErrTooManyRowsAffected)
+		noRows(t, repo, 40)
+		noRows(t, repo, 41)
+	})
+
+	t.Run("non-tx", func(t *testing.T) {
+		is := assert.New(t)
+		_, err := atm.DB().ExecContext(ctx, `insert into numbers(n) values (43), (44)`)
+		is.ErrorIs(err, dbtx.ErrTooManyRowsAffected)
+
+		// The statement is already executed.
+		n, err := repo.Find(ctx, 43)
+		is.Nil(err)
+		is.Equal(43, n)
+	})
+}
+
+func TestGetExists(t *testing.T) {
+	atm := dbtx.New(pgtest.DB(t))
+	repo := newNumberRepo(atm)
+	ctx := context.Background()
+
+	err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+		insertRow(t, repo, txCtx, 50)
+
+		is := assert.New(t)
+		n, err := dbtx.Get[int](txCtx, atm.Tx(txCtx), `select n from numbers where n = $1`, 50)
+		is.Nil(err)
+		is.Equal(50, n)
+
+		n, err = dbtx.Get[int](txCtx, atm.Tx(txCtx), `select n from numbers where n = $1`, 51)
+		is.ErrorIs(err, sql.ErrNoRows)
+		is.Equal(0, n)
+
+		ok, err := dbtx.Exists(txCtx, atm.Tx(txCtx), `select 1 from numbers where n = $1`, 50)
+		is.Nil(err)
+		is.True(ok)
+
+		ok, err = dbtx.Exists(txCtx, atm.Tx(txCtx), `select 1 from numbers where n = $1`, 51)
+		is.Nil(err)
+		is.False(ok)
+
+		return ErrRollback
+	})
+	assert.ErrorIs(t, err, ErrRollback)
+}
+
+func TestStrictNesting(t *testing.T) {
+	atm := dbtx.NewWithOptions(pgtest.DB(t), dbtx.WithStrictNesting())
+	err := atm.RunInTx(context.Background(), func(txCtx context.Context) error {
+		return atm.RunInTx(txCtx, func(context.Context) error {
+			return nil
+		})
+	})
+	assert.ErrorIs(t, err, dbtx.ErrNestedTransaction)
+}
+
+func TestRunInTxResult(t *testing.T) {
+	atm := dbtx.New(pgtest.DB(t))
+	repo := newNumberRepo(atm)
+	ctx := context.Background()
+
+	t.Run("commit", func(t *testing.T) {
+		n, err := dbtx.RunInTxResult(ctx, atm, func(txCtx context.Context) (int64, error) {
+			return repo.Create(txCtx, 1)
+		})
+
+		is := assert.New(t)
+		is.Nil(err)
+		is.Equal(int64(1), n)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		n, err := dbtx.RunInTxResult(ctx, atm, func(txCtx context.Context) (int64, error) {
+			insertRow(t, repo, txCtx, 2)
+
+			return 1, ErrRollback
+		})
+
+		is := assert.New(t)
+		is.ErrorIs(err, ErrRollback)
+		is.Equal(int64(0), n)
+		noRows(t, repo, 2)
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		assert.Panics(t, func() {
+			_, _ = dbtx.RunInTxResult(ctx, atm, func(txCtx context.Context) (int64, error) {
+				insertRow(t, repo, txCtx, 3)
+
+				panic("server error")
+			})
+		})
+
+		noRows(t, repo, 3)
+	})
+}
+
 func TestAtomicIntKeyPairLocked(t *testing.T) {
 	key := lock.NewIntKeyPair(1, 1)
 	atm := dbtx.New(pgtest.DB(t))
@@ -178,6 +496,42 @@ func TestAtomicIntLockKeyLocked(t *testing.T) {
 	wg.Wait()
 }
 
+func TestAtomicTryLockBool(t *testing.T) {
+	is := assert.New(t)
+
+	ctx := context.Background()
+	key := lock.NewIntKey(38)
+	atm := dbtx.New(pgtest.DB(t))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+			locked, err := lock.TryLockBool(txCtx, key)
+			is.True(locked)
+
+			time.Sleep(100 * time.Millisecond)
+
+			return err
+		})
+		is.Nil(err)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+		locked, err := lock.TryLockBool(txCtx, key)
+		is.False(locked)
+
+		return err
+	})
+	is.Nil(err)
+
+	wg.Wait()
+}
+
 func TestAtomicLocker(t *testing.T) {
 	is := assert.New(t)
 
@@ -236,6 +590,201 @@ func TestAtomicLocker(t *testing.T) {
 	wg.Wait()
 }
 
+func TestAtomicLockShared(t *testing.T) {
+	is := assert.New(t)
+
+	ctx := context.Background()
+	key := lock.NewStrKey("shared")
+	locker := lock.New(pgtest.DB(t))
+	atm := dbtx.New(pgtest.DB(t))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	// Both shared locks are held at the same time.
+	for range 2 {
+		go func() {
+			defer wg.Done()
+
+			err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+				if err := lock.TryLockShared(txCtx, key); err != nil {
+					return err
+				}
+
+				time.Sleep(100 * time.Millisecond)
+
+				return nil
+			})
+			is.Nil(err)
+		}()
+	}
+
+	// The exclusive lock fails while the shared locks are held.
+	time.Sleep(50 * time.Millisecond)
+	err := locker.TryLock(ctx, key, func(ctx context.Context) error {
+		return nil
+	})
+	is.ErrorIs(err, lock.ErrAlreadyLocked)
+
+	wg.Wait()
+}
+
+func TestAtomicLockTimeout(t *testing.T) {
+	is := assert.New(t)
+
+	ctx := context.Background()
+	key := lock.NewIntKey(35)
+	atm := dbtx.New(pgtest.DB(t))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+			if err := lock.Lock(txCtx, key); err != nil {
+				return err
+			}
+
+			time.Sleep(200 * time.Millisecond)
+
+			return nil
+		})
+		is.Nil(err)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+		return lock.LockTimeout(txCtx, key, 50*time.Millisecond)
+	})
+	is.ErrorIs(err, lock.ErrLockTimeout)
+
+	wg.Wait()
+
+	err = atm.RunInTx(ctx, func(txCtx context.Context) error {
+		return lock.LockTimeout(txCtx, key, 50*time.Millisecond)
+	})
+	is.Nil(err)
+}
+
+func TestAtomicLockMany(t *testing.T) {
+	is := assert.New(t)
+
+	ctx := context.Background()
+	a, b := lock.NewIntKey(36), lock.NewIntKeyPair(3, 6)
+	atm := dbtx.New(pgtest.DB(t))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	// Locking the keys in different order does not deadlock.
+	for _, keys := range [][]*lock.Key{{a, b}, {b, a}} {
+		go func() {
+			defer wg.Done()
+
+			err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+				if err := lock.LockMany(txCtx, keys...); err != nil {
+					return err
+				}
+
+				time.Sleep(50 * time.Millisecond)
+
+				return nil
+			})
+			is.Nil(err)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestAtomicLockHeld(t *testing.T) {
+	is := assert.New(t)
+
+	atm := dbtx.New(pgtest.DB(t))
+	err := atm.RunInTx(context.Background(), func(txCtx context.Context) error {
+		is.Nil(lock.Lock(txCtx, lock.NewIntKey(math.MinInt64)))
+		is.Nil(lock.LockShared(txCtx, lock.NewIntKeyPair(-1, math.MaxInt32)))
+
+		locks, err := lock.Held(txCtx)
+		if err != nil {
+			return err
+		}
+
+		is.Len(locks, 2)
+		is.Equal("Key(-9223372036854775808)", locks[0].Key.String())
+		is.False(locks[0].Shared)
+		is.True(locks[0].Granted)
+		is.Equal("Key(-1, 2147483647)", locks[1].Key.String())
+		is.True(locks[1].Shared)
+		is.True(locks[1].Granted)
+
+		return nil
+	})
+	is.Nil(err)
+}
+
+func TestLockSession(t *testing.T) {
+	ctx := context.Background()
+	key := lock.NewIntKey(33)
+	atm := dbtx.New(pgtest.DB(t))
+
+	conn, err := atm.Conn(ctx)
+	is := assert.New(t)
+	is.Nil(err)
+	defer conn.Close()
+
+	is.Nil(lock.LockSession(ctx, conn.DB(), key))
+
+	// The session lock outlives the transaction.
+	err = atm.RunInTx(ctx, func(txCtx context.Context) error {
+		return lock.TryLock(txCtx, key)
+	})
+	is.ErrorIs(err, lock.ErrAlreadyLocked)
+
+	unlocked, err := lock.Unlock(ctx, conn.DB(), key)
+	is.Nil(err)
+	is.True(unlocked)
+
+	unlocked, err = lock.Unlock(ctx, conn.DB(), key)
+	is.Nil(err)
+	is.False(unlocked)
+}
+
+func TestWithLock(t *testing.T) {
+	ctx := context.Background()
+	key := lock.NewIntKey(40)
+	atm := dbtx.New(pgtest.DB(t))
+
+	t.Run("outside tx", func(t *testing.T) {
+		err := lock.WithLock(ctx, key, func(ctx context.Context) error {
+			return nil
+		})
+		assert.ErrorIs(t, err, lock.ErrLockOutsideTx)
+		assert.ErrorIs(t, err, dbtx.ErrNotTransaction)
+	})
+
+	t.Run("session", func(t *testing.T) {
+		is := assert.New(t)
+
+		conn, err := atm.Conn(ctx)
+		is.Nil(err)
+		defer conn.Close()
+
+		is.Panics(func() {
+			_ = lock.WithSessionLock(ctx, conn.DB(), key, func(ctx context.Context) error {
+				panic("server error")
+			})
+		})
+
+		// The lock is released after panic.
+		unlocked, err := lock.Unlock(ctx, conn.DB(), key)
+		is.Nil(err)
+		is.False(unlocked)
+	})
+}
+
 func migrate(db *sql.DB) error {
 	_, err := db.Exec(`create table numbers(n int);`)
 	return err
@@ -0,0 +1,155 @@
+// Package dbtxmock provides a mock of dbtx.DBTX, to unit test the repository
+// without a database.
+package dbtxmock
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/alextanhongpin/dbtx"
+)
+
+var ErrNotStubbed = errors.New("dbtxmock: method not stubbed")
+
+var _ dbtx.DBTX = (*DB)(nil)
+
+// Call is the recorded call to the DB.
+type Call struct {
+	Method string
+	Query  string
+	Args   []any
+}
+
+// DB is a mock of dbtx.DBTX that records the calls, and returns the results
+// from the stubbed funcs.
+// The non-context methods call the stubbed funcs with context.Background().
+// ErrNotStubbed is returned if the func is not stubbed.
+type DB struct {
+	ExecFunc     func(ctx context.Context, query string, args ...any) (sql.Result, error)
+	PrepareFunc  func(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryFunc    func(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowFunc func(ctx context.Context, query string, args ...any) *sql.Row
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Calls returns the recorded calls in order.
+func (db *DB) Calls() []Call {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	calls := make([]Call, len(db.calls))
+	copy(calls, db.calls)
+
+	return calls
+}
+
+func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
+	db.record("Exec", query, args...)
+
+	return db.exec(context.Background(), query, args...)
+}
+
+func (db *DB) Prepare(query string) (*sql.Stmt, error) {
+	db.record("Prepare", query)
+
+	return db.prepare(context.Background(), query)
+}
+
+func (db *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	db.record("Query", query, args...)
+
+	return db.query(context.Background(), query, args...)
+}
+
+func (db *DB) QueryRow(query string, args ...any) *sql.Row {
+	db.record("QueryRow", query, args...)
+
+	return db.queryRow(context.Background(), query, args...)
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	db.record("ExecContext", query, args...)
+
+	return db.exec(ctx, query, args...)
+}
+
+func (db *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	db.record("PrepareContext", query)
+
+	return db.prepare(ctx, query)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	db.record("QueryContext", query, args...)
+
+	return db.query(ctx, query, args...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	db.record("QueryRowContext", query, args...)
+
+	return db.queryRow(ctx, query, args...)
+}
+
+func (db *DB) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if db.ExecFunc == nil {
+		return nil, ErrNotStubbed
+	}
+
+	return db.ExecFunc(ctx, query, args...)
+}
+
+func (db *DB) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	if db.PrepareFunc == nil {
+		return nil, ErrNotStubbed
+	}
+
+	return db.PrepareFunc(ctx, query)
+}
+
+func (db *DB) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if db.QueryFunc == nil {
+		return nil, ErrNotStubbed
+	}
+
+	return db.QueryFunc(ctx, query, args...)
+}
+
+func (db *DB) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	if db.QueryRowFunc == nil {
+		return ErrRow(ErrNotStubbed)
+	}
+
+	return db.QueryRowFunc(ctx, query, args...)
+}
+
+func (db *DB) record(method, query string, args ...any) {
+	db.mu.Lock()
+	db.calls = append(db.calls, Call{
+		Method: method,
+		Query:  query,
+		Args:   args,
+	})
+	db.mu.Unlock()
+}
+
+var _ sql.Result = Result{}
+
+// Result is a fake sql.Result.
+type Result struct {
+	LastID   int64
+	Affected int64
+	Err      error
+}
+
+func (r Result) LastInsertId() (int64, error) {
+	return r.LastID, r.Err
+}
+
+func (r Result) RowsAffected() (int64, error) {
+	return r.Affected, r.Err
+}
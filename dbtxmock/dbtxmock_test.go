@@ -0,0 +1,83 @@
+package dbtxmock_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/alextanhongpin/dbtx/dbtxmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+
+	db := &dbtxmock.DB{
+		ExecFunc: func(ctx context.Context, query string, args ...any) (sql.Result, error) {
+			return dbtxmock.Result{Affected: 1}, nil
+		},
+		QueryRowFunc: func(ctx context.Context, query string, args ...any) *sql.Row {
+			return dbtxmock.Row([]string{"id", "name"}, 1, "john")
+		},
+	}
+
+	res, err := db.ExecContext(ctx, "insert into users(name) values ($1)", "john")
+	is.Nil(err)
+	n, err := res.RowsAffected()
+	is.Nil(err)
+	is.Equal(int64(1), n)
+
+	var id int
+	var name string
+	err = db.QueryRow("select id, name from users where id = $1", 1).Scan(&id, &name)
+	is.Nil(err)
+	is.Equal(1, id)
+	is.Equal("john", name)
+
+	_, err = db.QueryContext(ctx, "select * from users")
+	is.ErrorIs(err, dbtxmock.ErrNotStubbed)
+
+	is.Equal([]dbtxmock.Call{
+		{Method: "ExecContext", Query: "insert into users(name) values ($1)", Args: []any{"john"}},
+		{Method: "QueryRow", Query: "select id, name from users where id = $1", Args: []any{1}},
+		{Method: "QueryContext", Query: "select * from users"},
+	}, db.Calls())
+}
+
+func TestRows(t *testing.T) {
+	is := assert.New(t)
+
+	rows := dbtxmock.Rows([]string{"id", "name"},
+		[]any{1, "john"},
+		[]any{2, "jane"},
+	)
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var id int
+		var name string
+		is.Nil(rows.Scan(&id, &name))
+		names = append(names, name)
+	}
+	is.Nil(rows.Err())
+	is.Equal([]string{"john", "jane"}, names)
+}
+
+func TestRow(t *testing.T) {
+	t.Run("no rows", func(t *testing.T) {
+		var id int
+		err := dbtxmock.Row([]string{"id"}).Scan(&id)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		bad := errors.New("bad")
+
+		var id int
+		err := dbtxmock.ErrRow(bad).Scan(&id)
+		assert.ErrorIs(t, err, bad)
+	})
+}
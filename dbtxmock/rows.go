@@ -0,0 +1,61 @@
+package dbtxmock
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/alextanhongpin/dbtx/internal/sqlrows"
+)
+
+// Rows returns the *sql.Rows with the given columns and values, where each
+// values is a row.
+// Panics if the values cannot be converted to driver.Value.
+func Rows(columns []string, values ...[]any) *sql.Rows {
+	rows, err := sqlrows.Rows(&sqlrows.Result{
+		Columns: columns,
+		Values:  convert(columns, values),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return rows
+}
+
+// Row returns the *sql.Row with the given columns and values.
+// Scan returns sql.ErrNoRows if values is empty.
+// Panics if the values cannot be converted to driver.Value.
+func Row(columns []string, values ...any) *sql.Row {
+	r := &sqlrows.Result{Columns: columns}
+	if len(values) > 0 {
+		r.Values = convert(columns, [][]any{values})
+	}
+
+	return sqlrows.Row(r)
+}
+
+// ErrRow returns the *sql.Row that returns the err on Scan.
+func ErrRow(err error) *sql.Row {
+	return sqlrows.Row(&sqlrows.Result{Err: err})
+}
+
+func convert(columns []string, values [][]any) [][]driver.Value {
+	res := make([][]driver.Value, len(values))
+	for i, row := range values {
+		if len(row) != len(columns) {
+			panic(fmt.Errorf("dbtxmock: row %d has %d values, want %d", i, len(row), len(columns)))
+		}
+
+		res[i] = make([]driver.Value, len(row))
+		for j, v := range row {
+			dv, err := driver.DefaultParameterConverter.ConvertValue(v)
+			if err != nil {
+				panic(fmt.Errorf("dbtxmock: row %d column %q: %w", i, columns[j], err))
+			}
+			res[i][j] = dv
+		}
+	}
+
+	return res
+}
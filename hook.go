@@ -0,0 +1,36 @@
+package dbtx
+
+import "context"
+
+// OnCommit registers the fn to be called after the transaction commits.
+// The fn is not called if the transaction is rolled back.
+// Nested RunInTx shares the same transaction, so fn is only called once when
+// the parent commits.
+// If the context does not contain a transaction, fn is called immediately,
+// since the operations are already committed.
+func OnCommit(ctx context.Context, fn func()) {
+	tx, ok := value(ctx)
+	if !ok {
+		fn()
+		return
+	}
+
+	tx.addOnCommit(fn)
+}
+
+// OnBeforeCommit registers the fn to be called within the transaction, right
+// before the transaction commits.
+// The callbacks are called in the order they are registered. If any of them
+// returns an error, the remaining callbacks are skipped and the transaction is
+// rolled back.
+// Returns ErrNotTransaction if the context does not contain a transaction.
+func OnBeforeCommit(ctx context.Context, fn func(context.Context) error) error {
+	tx, ok := value(ctx)
+	if !ok {
+		return ErrNotTransaction
+	}
+
+	tx.addOnBeforeCommit(fn)
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package dbtx_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alextanhongpin/core/storage/pg/pgtest"
+	"github.com/alextanhongpin/dbtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnCommit(t *testing.T) {
+	atm := dbtx.New(pgtest.DB(t))
+	ctx := context.Background()
+
+	t.Run("commit", func(t *testing.T) {
+		var calls []int
+		err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+			dbtx.OnCommit(txCtx, func() {
+				calls = append(calls, 1)
+			})
+
+			return atm.RunInTx(txCtx, func(txCtx context.Context) error {
+				dbtx.OnCommit(txCtx, func() {
+					calls = append(calls, 2)
+				})
+
+				return nil
+			})
+		})
+
+		is := assert.New(t)
+		is.Nil(err)
+		is.Equal([]int{1, 2}, calls)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		var called bool
+		err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+			dbtx.OnCommit(txCtx, func() {
+				called = true
+			})
+
+			return ErrRollback
+		})
+
+		is := assert.New(t)
+		is.ErrorIs(err, ErrRollback)
+		is.False(called)
+	})
+
+	t.Run("no tx", func(t *testing.T) {
+		var called bool
+		dbtx.OnCommit(ctx, func() {
+			called = true
+		})
+
+		assert.True(t, called)
+	})
+}
+
+func TestOnBeforeCommit(t *testing.T) {
+	atm := dbtx.New(pgtest.DB(t))
+	repo := newNumberRepo(atm)
+	ctx := context.Background()
+
+	t.Run("commit", func(t *testing.T) {
+		is := assert.New(t)
+
+		var calls []int
+		err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+			is.Nil(dbtx.OnBeforeCommit(txCtx, func(txCtx context.Context) error {
+				calls = append(calls, 1)
+				_, err := repo.Create(txCtx, 10)
+				return err
+			}))
+			is.Nil(dbtx.OnBeforeCommit(txCtx, func(txCtx context.Context) error {
+				calls = append(calls, 2)
+				return nil
+			}))
+
+			return nil
+		})
+		is.Nil(err)
+		is.Equal([]int{1, 2}, calls)
+
+		n, err := repo.Find(ctx, 10)
+		is.Nil(err)
+		is.Equal(10, n)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		is := assert.New(t)
+
+		var calls []int
+		var committed bool
+		err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+			insertRow(t, repo, txCtx, 11)
+
+			dbtx.OnCommit(txCtx, func() {
+				committed = true
+			})
+			is.Nil(dbtx.OnBeforeCommit(txCtx, func(txCtx context.Context) error {
+				calls = append(calls, 1)
+				return ErrRollback
+			}))
+			is.Nil(dbtx.OnBeforeCommit(txCtx, func(txCtx context.Context) error {
+				calls = append(calls, 2)
+				return nil
+			}))
+
+			return nil
+		})
+		is.ErrorIs(err, ErrRollback)
+		is.Equal([]int{1}, calls)
+		is.False(committed)
+		noRows(t, repo, 11)
+	})
+
+	t.Run("no tx", func(t *testing.T) {
+		err := dbtx.OnBeforeCommit(ctx, func(context.Context) error {
+			return nil
+		})
+		assert.ErrorIs(t, err, dbtx.ErrNotTransaction)
+	})
+}
+
+func TestWithHook(t *testing.T) {
+	type ctxKey string
+
+	type call struct {
+		method string
+		query  string
+		err    error
+		value  any
+	}
+
+	var calls []call
+	atm := dbtx.New(pgtest.DB(t), dbtx.WithHook(
+		func(ctx context.Context, method, query string, args []any) context.Context {
+			return context.WithValue(ctx, ctxKey("method"), method)
+		},
+		func(ctx context.Context, method, query string, err error, dur time.Duration) {
+			calls = append(calls, call{
+				method: method,
+				query:  query,
+				err:    err,
+				value:  ctx.Value(ctxKey("method")),
+			})
+		},
+	))
+	ctx := context.Background()
+
+	is := assert.New(t)
+	var n int
+	is.Nil(atm.DB().QueryRowContext(ctx, `select 1`).Scan(&n))
+
+	_, err := atm.DB().ExecContext(ctx, `select invalid`)
+	is.NotNil(err)
+
+	is.Len(calls, 2)
+	is.Equal("QueryRowContext", calls[0].method)
+	is.Equal("select 1", calls[0].query)
+	is.Nil(calls[0].err)
+	is.Equal("QueryRowContext", calls[0].value)
+	is.Equal("ExecContext", calls[1].method)
+	is.Equal(err, calls[1].err)
+}
+
+func TestWithQueryCounter(t *testing.T) {
+	atm := dbtx.New(pgtest.DB(t), dbtx.WithQueryCounter())
+	ctx := dbtx.CountQueries(context.Background())
+
+	// findUser simulates an N+1 query, where each user is fetched in a loop.
+	findUser := func(ctx context.Context, id int) error {
+		var n int
+		return atm.DBTx(ctx).QueryRowContext(ctx, `select $1::int`, id).Scan(&n)
+	}
+
+	is := assert.New(t)
+	err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+		for i := range 10 {
+			if err := findUser(txCtx, i); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	is.Nil(err)
+
+	// One query per user, excluding the BEGIN and COMMIT.
+	is.Equal(10, dbtx.QueryCount(ctx), "N+1 query detected")
+	is.Equal(0, dbtx.QueryCount(context.Background()))
+}
@@ -0,0 +1,140 @@
+// Package sqlrows creates *sql.Rows and *sql.Row from the values in memory,
+// since they can only be created by database/sql.
+package sqlrows
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// The results are served by a single in-memory *sql.DB.
+// Each result is registered with a unique id, which is passed as the query.
+var (
+	once    sync.Once
+	db      *sql.DB
+	id      atomic.Int64
+	results sync.Map
+)
+
+// Result is the columns and values that are returned as rows.
+// If Err is set, the query fails with the error instead.
+type Result struct {
+	Columns []string
+	// Types is the database type name of the columns, which is optional.
+	Types  []string
+	Values [][]driver.Value
+	Err    error
+}
+
+// Rows returns the *sql.Rows of the result.
+func Rows(r *Result) (*sql.Rows, error) {
+	return open().QueryContext(context.Background(), register(r))
+}
+
+// Row returns the *sql.Row of the result.
+// Scan returns sql.ErrNoRows if there are no values.
+func Row(r *Result) *sql.Row {
+	return open().QueryRowContext(context.Background(), register(r))
+}
+
+func register(r *Result) string {
+	key := strconv.FormatInt(id.Add(1), 10)
+	results.Store(key, r)
+
+	return key
+}
+
+func open() *sql.DB {
+	once.Do(func() {
+		db = sql.OpenDB(connector{})
+	})
+
+	return db
+}
+
+type connector struct{}
+
+func (connector) Connect(context.Context) (driver.Conn, error) {
+	return conn{}, nil
+}
+
+func (connector) Driver() driver.Driver {
+	return drv{}
+}
+
+type drv struct{}
+
+func (drv) Open(string) (driver.Conn, error) {
+	return conn{}, nil
+}
+
+var errNotSupported = errors.New("sqlrows: not supported")
+
+type conn struct{}
+
+func (conn) Prepare(string) (driver.Stmt, error) {
+	return nil, errNotSupported
+}
+
+func (conn) Close() error {
+	return nil
+}
+
+func (conn) Begin() (driver.Tx, error) {
+	return nil, errNotSupported
+}
+
+func (conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	v, ok := results.LoadAndDelete(query)
+	if !ok {
+		return nil, fmt.Errorf("sqlrows: unknown result %q", query)
+	}
+
+	r := v.(*Result)
+	if r.Err != nil {
+		return nil, r.Err
+	}
+
+	return &rows{res: r}, nil
+}
+
+var _ driver.RowsColumnTypeDatabaseTypeName = (*rows)(nil)
+
+type rows struct {
+	res *Result
+	i   int
+}
+
+func (r *rows) Columns() []string {
+	return r.res.Columns
+}
+
+func (r *rows) ColumnTypeDatabaseTypeName(i int) string {
+	if i < len(r.res.Types) {
+		return r.res.Types[i]
+	}
+
+	return ""
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.i >= len(r.res.Values) {
+		return io.EOF
+	}
+
+	copy(dest, r.res.Values[r.i])
+	r.i++
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package dbtx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/alextanhongpin/dbtx/internal/sqlrows"
+)
+
+// leakDetector tracks the open transactions, and the usage of transactions
+// after they are closed.
+type leakDetector struct {
+	mu     sync.Mutex
+	open   int
+	leaked int
+	report func(error)
+}
+
+func (l *leakDetector) begin() {
+	l.mu.Lock()
+	l.open++
+	l.mu.Unlock()
+}
+
+func (l *leakDetector) end(t *Tx) {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+
+	l.mu.Lock()
+	l.open--
+	l.mu.Unlock()
+}
+
+func (l *leakDetector) leak(query string) {
+	l.mu.Lock()
+	l.leaked++
+	l.mu.Unlock()
+
+	if l.report != nil {
+		l.report(fmt.Errorf("%w: %s", ErrTxAlreadyClosed, query))
+	}
+}
+
+func (l *leakDetector) err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.open == 0 && l.leaked == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %d open, %d used after closed", ErrTxLeaked, l.open, l.leaked)
+}
+
+func (l *leakDetector) guard(t *Tx) func(DBTX) DBTX {
+	return func(dbtx DBTX) DBTX {
+		return &txGuard{dbtx: dbtx, t: t, l: l}
+	}
+}
+
+var _ DBTX = (*txGuard)(nil)
+
+// txGuard returns ErrTxAlreadyClosed when the transaction is used after it is
+// committed or rolled back.
+type txGuard struct {
+	dbtx DBTX
+	t    *Tx
+	l    *leakDetector
+}
+
+func (g *txGuard) Exec(query string, args ...any) (sql.Result, error) {
+	if g.closed(query) {
+		return nil, ErrTxAlreadyClosed
+	}
+
+	return g.dbtx.Exec(query, args...)
+}
+
+func (g *txGuard) Prepare(query string) (*sql.Stmt, error) {
+	if g.closed(query) {
+		return nil, ErrTxAlreadyClosed
+	}
+
+	return g.dbtx.Prepare(query)
+}
+
+func (g *txGuard) Query(query string, args ...any) (*sql.Rows, error) {
+	if g.closed(query) {
+		return nil, ErrTxAlreadyClosed
+	}
+
+	return g.dbtx.Query(query, args...)
+}
+
+func (g *txGuard) QueryRow(query string, args ...any) *sql.Row {
+	if g.closed(query) {
+		return sqlrows.Row(&sqlrows.Result{Err: ErrTxAlreadyClosed})
+	}
+
+	return g.dbtx.QueryRow(query, args...)
+}
+
+func (g *txGuard) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if g.closed(query) {
+		return nil, ErrTxAlreadyClosed
+	}
+
+	return g.dbtx.ExecContext(ctx, query, args...)
+}
+
+func (g *txGuard) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	if g.closed(query) {
+		return nil, ErrTxAlreadyClosed
+	}
+
+	return g.dbtx.PrepareContext(ctx, query)
+}
+
+func (g *txGuard) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if g.closed(query) {
+		return nil, ErrTxAlreadyClosed
+	}
+
+	return g.dbtx.QueryContext(ctx, query, args...)
+}
+
+func (g *txGuard) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if g.closed(query) {
+		return sqlrows.Row(&sqlrows.Result{Err: ErrTxAlreadyClosed})
+	}
+
+	return g.dbtx.QueryRowContext(ctx, query, args...)
+}
+
+// closed returns true and records the leak if the transaction is closed.
+func (g *txGuard) closed(query string) bool {
+	g.t.mu.Lock()
+	closed := g.t.closed
+	g.t.mu.Unlock()
+
+	if closed {
+		g.l.leak(query)
+	}
+
+	return closed
+}
@@ -0,0 +1,49 @@
+package dbtx_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/alextanhongpin/core/storage/pg/pgtest"
+	"github.com/alextanhongpin/dbtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeakDetection(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("postgres", pgtest.DSN())
+
+	is := assert.New(t)
+	is.Nil(err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	var leaks []error
+	atm := dbtx.NewWithOptions(db, dbtx.WithLeakReporter(func(err error) {
+		leaks = append(leaks, err)
+	}))
+
+	var leakedCtx context.Context
+	err = atm.RunInTx(ctx, func(txCtx context.Context) error {
+		leakedCtx = txCtx
+
+		_, err := atm.Tx(txCtx).ExecContext(txCtx, `select 1`)
+		return err
+	})
+	is.Nil(err)
+
+	_, err = atm.Tx(leakedCtx).ExecContext(ctx, `select 1`)
+	is.ErrorIs(err, dbtx.ErrTxAlreadyClosed)
+
+	var n int
+	err = atm.Tx(leakedCtx).QueryRowContext(ctx, `select 2`).Scan(&n)
+	is.ErrorIs(err, dbtx.ErrTxAlreadyClosed)
+
+	is.Len(leaks, 2)
+	is.ErrorIs(leaks[0], dbtx.ErrTxAlreadyClosed)
+	is.ErrorContains(leaks[1], "select 2")
+	is.ErrorIs(atm.CheckLeaks(), dbtx.ErrTxLeaked)
+	is.Nil(db.Ping())
+}
@@ -3,6 +3,8 @@ package dbtx
 import (
 	"context"
 	"database/sql"
+	"slices"
+	"time"
 )
 
 type logger interface {
@@ -13,64 +15,153 @@ var _ DBTX = (*Logger)(nil)
 
 // Logger logs the query and args.
 type Logger struct {
-	dbtx DBTX
-	l    logger
+	dbtx          DBTX
+	l             logger
+	slowThreshold time.Duration
+	redactor      func(query string, args []any) []any
+	normalize     bool
 }
 
-func WithLogger(l logger) func(DBTX) DBTX {
+// LoggerOption configures the Logger.
+type LoggerOption func(*Logger)
+
+// WithSlowThreshold only logs the queries that takes longer than the given
+// duration to execute.
+// For QueryRow, only the duration of the call is measured, since the error is
+// only returned when scanning.
+func WithSlowThreshold(d time.Duration) LoggerOption {
+	return func(l *Logger) {
+		l.slowThreshold = d
+	}
+}
+
+// WithRedactor redacts the args before they are logged, e.g. to mask
+// sensitive data. The underlying DBTX still receives the original args.
+func WithRedactor(fn func(query string, args []any) []any) LoggerOption {
+	return func(l *Logger) {
+		l.redactor = fn
+	}
+}
+
+// WithNormalize logs the query with Normalize, so that the logs can be grouped
+// by the shape of the query. The underlying DBTX still receives the original
+// query, which is available to the logger through RawQuery.
+func WithNormalize() LoggerOption {
+	return func(l *Logger) {
+		l.normalize = true
+	}
+}
+
+var rawQueryCtxKey = ctxKey("raw_query")
+
+// RawQuery returns the original query from the context passed to the logger,
+// when the query is normalized with WithNormalize.
+func RawQuery(ctx context.Context) (string, bool) {
+	query, ok := ctx.Value(rawQueryCtxKey).(string)
+	return query, ok
+}
+
+// RedactAll replaces all the args with "?".
+func RedactAll(query string, args []any) []any {
+	res := make([]any, len(args))
+	for i := range args {
+		res[i] = "?"
+	}
+
+	return res
+}
+
+func WithLogger(l logger, opts ...LoggerOption) func(DBTX) DBTX {
 	return func(dbtx DBTX) DBTX {
-		return NewLogger(dbtx, l)
+		return NewLogger(dbtx, l, opts...)
 	}
 }
 
-func NewLogger(dbtx DBTX, l logger) *Logger {
-	return &Logger{dbtx: dbtx, l: l}
+func NewLogger(dbtx DBTX, l logger, opts ...LoggerOption) *Logger {
+	lg := &Logger{dbtx: dbtx, l: l}
+	for _, opt := range opts {
+		opt(lg)
+	}
+
+	return lg
 }
 
 func (r *Logger) Exec(query string, args ...any) (sql.Result, error) {
-	r.l.Log(context.Background(), "Exec", query, args...)
+	defer r.log(context.Background(), "Exec", query, args...)()
 
 	return r.dbtx.Exec(query, args...)
 }
 
 func (r *Logger) Prepare(query string) (*sql.Stmt, error) {
-	r.l.Log(context.Background(), "Prepare", query)
+	defer r.log(context.Background(), "Prepare", query)()
 
 	return r.dbtx.Prepare(query)
 }
 
 func (r *Logger) Query(query string, args ...any) (*sql.Rows, error) {
-	r.l.Log(context.Background(), "Query", query, args...)
+	defer r.log(context.Background(), "Query", query, args...)()
 
 	return r.dbtx.Query(query, args...)
 }
 
 func (r *Logger) QueryRow(query string, args ...any) *sql.Row {
-	r.l.Log(context.Background(), "QueryRow", query, args...)
+	defer r.log(context.Background(), "QueryRow", query, args...)()
 
 	return r.dbtx.QueryRow(query, args...)
 }
 
 func (r *Logger) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
-	r.l.Log(ctx, "ExecContext", query, args...)
+	defer r.log(ctx, "ExecContext", query, args...)()
 
 	return r.dbtx.ExecContext(ctx, query, args...)
 }
 
 func (r *Logger) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
-	r.l.Log(ctx, "PrepareContext", query)
+	defer r.log(ctx, "PrepareContext", query)()
 
 	return r.dbtx.PrepareContext(ctx, query)
 }
 
 func (r *Logger) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
-	r.l.Log(ctx, "QueryContext", query, args...)
+	defer r.log(ctx, "QueryContext", query, args...)()
 
 	return r.dbtx.QueryContext(ctx, query, args...)
 }
 
 func (r *Logger) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
-	r.l.Log(ctx, "QueryRowContext", query, args...)
+	defer r.log(ctx, "QueryRowContext", query, args...)()
 
 	return r.dbtx.QueryRowContext(ctx, query, args...)
 }
+
+// log logs the query before the call, so that queries that hang or panic are
+// still logged. When the slow threshold is set, the query is only logged by
+// the returned func, which must be deferred until the call returns.
+func (r *Logger) log(ctx context.Context, method, query string, args ...any) func() {
+	if r.slowThreshold <= 0 {
+		r.write(ctx, method, query, args...)
+
+		return func() {}
+	}
+
+	start := time.Now()
+
+	return func() {
+		if time.Since(start) >= r.slowThreshold {
+			r.write(ctx, method, query, args...)
+		}
+	}
+}
+
+func (r *Logger) write(ctx context.Context, method, query string, args ...any) {
+	if r.redactor != nil {
+		args = r.redactor(query, slices.Clone(args))
+	}
+
+	if r.normalize {
+		ctx = context.WithValue(ctx, rawQueryCtxKey, query)
+		query = Normalize(query)
+	}
+
+	r.l.Log(ctx, method, query, args...)
+}
@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/alextanhongpin/dbtx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _ dbtx.DBTX = (*Metrics)(nil)
+
+type config struct {
+	namespace    string
+	durationName string
+	errorsName   string
+	buckets      []float64
+}
+
+// Option configures the metrics.
+type Option func(*config)
+
+// WithNamespace sets the namespace of the metrics.
+func WithNamespace(namespace string) Option {
+	return func(c *config) {
+		c.namespace = namespace
+	}
+}
+
+// WithDurationName sets the name of the query duration histogram.
+func WithDurationName(name string) Option {
+	return func(c *config) {
+		c.durationName = name
+	}
+}
+
+// WithErrorsName sets the name of the query errors counter.
+func WithErrorsName(name string) Option {
+	return func(c *config) {
+		c.errorsName = name
+	}
+}
+
+// WithBuckets sets the buckets of the query duration histogram.
+func WithBuckets(buckets []float64) Option {
+	return func(c *config) {
+		c.buckets = buckets
+	}
+}
+
+type collector struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+// WithMetrics registers the metrics to the registerer, and returns a middleware
+// that records the duration and errors of each query, labelled by method.
+func WithMetrics(registerer prometheus.Registerer, opts ...Option) func(dbtx.DBTX) dbtx.DBTX {
+	cfg := &config{
+		durationName: "query_duration_seconds",
+		errorsName:   "query_errors_total",
+		buckets:      prometheus.DefBuckets,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	c := &collector{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: cfg.namespace,
+			Name:      cfg.durationName,
+			Help:      "The duration of the database queries in seconds.",
+			Buckets:   cfg.buckets,
+		}, []string{"method"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Name:      cfg.errorsName,
+			Help:      "The number of failed database queries.",
+		}, []string{"method"}),
+	}
+	registerer.MustRegister(c.duration, c.errors)
+
+	return func(db dbtx.DBTX) dbtx.DBTX {
+		return &Metrics{dbtx: db, c: c}
+	}
+}
+
+// Metrics records the duration and errors of the queries.
+type Metrics struct {
+	dbtx dbtx.DBTX
+	c    *collector
+}
+
+func (m *Metrics) Exec(query string, args ...any) (sql.Result, error) {
+	defer m.observe("Exec", time.Now())
+
+	res, err := m.dbtx.Exec(query, args...)
+	m.error("Exec", err)
+
+	return res, err
+}
+
+func (m *Metrics) Prepare(query string) (*sql.Stmt, error) {
+	defer m.observe("Prepare", time.Now())
+
+	stmt, err := m.dbtx.Prepare(query)
+	m.error("Prepare", err)
+
+	return stmt, err
+}
+
+func (m *Metrics) Query(query string, args ...any) (*sql.Rows, error) {
+	defer m.observe("Query", time.Now())
+
+	rows, err := m.dbtx.Query(query, args...)
+	m.error("Query", err)
+
+	return rows, err
+}
+
+func (m *Metrics) QueryRow(query string, args ...any) *sql.Row {
+	defer m.observe("QueryRow", time.Now())
+
+	row := m.dbtx.QueryRow(query, args...)
+	m.error("QueryRow", row.Err())
+
+	return row
+}
+
+func (m *Metrics) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	defer m.observe("ExecContext", time.Now())
+
+	res, err := m.dbtx.ExecContext(ctx, query, args...)
+	m.error("ExecContext", err)
+
+	return res, err
+}
+
+func (m *Metrics) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	defer m.observe("PrepareContext", time.Now())
+
+	stmt, err := m.dbtx.PrepareContext(ctx, query)
+	m.error("PrepareContext", err)
+
+	return stmt, err
+}
+
+func (m *Metrics) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	defer m.observe("QueryContext", time.Now())
+
+	rows, err := m.dbtx.QueryContext(ctx, query, args...)
+	m.error("QueryContext", err)
+
+	return rows, err
+}
+
+func (m *Metrics) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	defer m.observe("QueryRowContext", time.Now())
+
+	row := m.dbtx.QueryRowContext(ctx, query, args...)
+	m.error("QueryRowContext", row.Err())
+
+	return row
+}
+
+func (m *Metrics) observe(method string, start time.Time) {
+	m.c.duration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) error(method string, err error) {
+	if err != nil {
+		m.c.errors.WithLabelValues(method).Inc()
+	}
+}
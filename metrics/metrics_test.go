@@ -0,0 +1,108 @@
+package metrics_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alextanhongpin/dbtx"
+	"github.com/alextanhongpin/dbtx/dbtxmock"
+	"github.com/alextanhongpin/dbtx/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+var ErrBadQuery = errors.New("bad query")
+
+func TestWithMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	db := newDB(t, metrics.WithMetrics(reg,
+		metrics.WithNamespace("app"),
+		metrics.WithBuckets([]float64{1, 5}),
+	))
+	ctx := context.Background()
+
+	is := assert.New(t)
+	_, err := db.ExecContext(ctx, `select 1`)
+	is.Nil(err)
+
+	// The duration is recorded even if the query fails.
+	_, err = db.ExecContext(ctx, `select invalid`)
+	is.ErrorIs(err, ErrBadQuery)
+
+	var n int
+	is.Nil(db.QueryRowContext(ctx, `select 1`).Scan(&n))
+
+	is.Equal(map[string]uint64{
+		"ExecContext":     2,
+		"QueryRowContext": 1,
+	}, sampleCounts(t, reg, "app_query_duration_seconds"))
+
+	is.Nil(testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP app_query_errors_total The number of failed database queries.
+# TYPE app_query_errors_total counter
+app_query_errors_total{method="ExecContext"} 1
+`), "app_query_errors_total"))
+}
+
+func TestWithMetricsNames(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	db := newDB(t, metrics.WithMetrics(reg,
+		metrics.WithDurationName("db_duration_seconds"),
+		metrics.WithErrorsName("db_errors_total"),
+	))
+
+	is := assert.New(t)
+	_, err := db.Exec(`select invalid`)
+	is.ErrorIs(err, ErrBadQuery)
+
+	is.Equal(map[string]uint64{"Exec": 1}, sampleCounts(t, reg, "db_duration_seconds"))
+	is.Equal(1, testutil.CollectAndCount(reg, "db_errors_total"))
+}
+
+func newDB(t *testing.T, fn func(dbtx.DBTX) dbtx.DBTX) dbtx.DBTX {
+	t.Helper()
+
+	return fn(&dbtxmock.DB{
+		ExecFunc: func(ctx context.Context, query string, args ...any) (sql.Result, error) {
+			if query == `select invalid` {
+				return nil, ErrBadQuery
+			}
+
+			return dbtxmock.Result{}, nil
+		},
+		QueryRowFunc: func(ctx context.Context, query string, args ...any) *sql.Row {
+			return dbtxmock.Row([]string{"n"}, 1)
+		},
+	})
+}
+
+// sampleCounts returns the number of observations of the histogram by method.
+func sampleCounts(t *testing.T, reg *prometheus.Registry, name string) map[string]uint64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := make(map[string]uint64)
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "method" {
+					res[l.GetValue()] = m.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,162 @@
+package dbtx
+
+import "strings"
+
+// Normalize returns the shape of the query, so that queries that only differ
+// by the literal values can be grouped together, e.g. in logs and metrics.
+// The whitespaces are collapsed, the comments are removed, and the string,
+// dollar-quoted string and numeric literals are replaced with "?".
+// The placeholders, e.g. $1, and quoted identifiers are kept as it is.
+func Normalize(query string) string {
+	var sb strings.Builder
+	sb.Grow(len(query))
+
+	var space bool
+	write := func(s string) {
+		if space && sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		space = false
+		sb.WriteString(s)
+	}
+
+	n := len(query)
+	for i := 0; i < n; {
+		c := query[i]
+		switch {
+		case isSpace(c):
+			space = true
+			i++
+		case strings.HasPrefix(query[i:], "--"):
+			if j := strings.IndexByte(query[i:], '\n'); j >= 0 {
+				i += j
+			} else {
+				i = n
+			}
+			space = true
+		case strings.HasPrefix(query[i:], "/*"):
+			if j := strings.Index(query[i+2:], "*/"); j >= 0 {
+				i += j + 4
+			} else {
+				i = n
+			}
+			space = true
+		case c == '\'':
+			i = skipQuoted(query, i, false)
+			write("?")
+		case (c == 'e' || c == 'E') && i+1 < n && query[i+1] == '\'':
+			// Escape string, e.g. E'it\'s', where the quote can be escaped
+			// with backslash.
+			i = skipQuoted(query, i+1, true)
+			write("?")
+		case c == '"':
+			j := skipQuoted(query, i, false)
+			write(query[i:j])
+			i = j
+		case c == '$':
+			if tag, ok := dollarTag(query[i:]); ok {
+				if j := strings.Index(query[i+len(tag):], tag); j >= 0 {
+					i += len(tag) + j + len(tag)
+				} else {
+					i = n
+				}
+				write("?")
+
+				continue
+			}
+
+			// Placeholder, e.g. $1.
+			j := i + 1
+			for j < n && isDigit(query[j]) {
+				j++
+			}
+			write(query[i:j])
+			i = j
+		case isDigit(c) || (c == '.' && i+1 < n && isDigit(query[i+1])):
+			j := i
+			for j < n && (isDigit(query[j]) || query[j] == '.') {
+				j++
+			}
+			// Exponent, e.g. 1e-10.
+			if j < n && (query[j] == 'e' || query[j] == 'E') {
+				k := j + 1
+				if k < n && (query[k] == '+' || query[k] == '-') {
+					k++
+				}
+				if k < n && isDigit(query[k]) {
+					j = k
+					for j < n && isDigit(query[j]) {
+						j++
+					}
+				}
+			}
+			write("?")
+			i = j
+		case isIdent(c):
+			j := i
+			for j < n && (isIdent(query[j]) || isDigit(query[j])) {
+				j++
+			}
+			write(query[i:j])
+			i = j
+		default:
+			write(query[i : i+1])
+			i++
+		}
+	}
+
+	return sb.String()
+}
+
+// skipQuoted returns the index after the closing quote.
+// If backslash is true, the character after the backslash is skipped.
+func skipQuoted(query string, i int, backslash bool) int {
+	q := query[i]
+	for j := i + 1; j < len(query); j++ {
+		if backslash && query[j] == '\\' {
+			j++
+			continue
+		}
+		if query[j] != q {
+			continue
+		}
+		// The quote is escaped by doubling it, e.g. 'it''s'.
+		if j+1 < len(query) && query[j+1] == q {
+			j++
+			continue
+		}
+
+		return j + 1
+	}
+
+	return len(query)
+}
+
+// dollarTag returns the tag of the dollar-quoted string, e.g. $$ or $body$.
+func dollarTag(s string) (string, bool) {
+	for j := 1; j < len(s); j++ {
+		c := s[j]
+		if c == '$' {
+			return s[:j+1], true
+		}
+		// The tag cannot start with a digit, to differentiate it from the
+		// placeholder.
+		if !isIdent(c) && !(j > 1 && isDigit(c)) {
+			return "", false
+		}
+	}
+
+	return "", false
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c >= 0x80
+}
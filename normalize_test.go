@@ -0,0 +1,35 @@
+package dbtx_test
+
+import (
+	"testing"
+
+	"github.com/alextanhongpin/dbtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"whitespace", "select *\n\tfrom  users", "select * from users"},
+		{"string", "select * from users where name = 'john'", "select * from users where name = ?"},
+		{"escaped string", "select 'it''s'", "select ?"},
+		{"escape string", `select E'it\'s', e'\\', 1 from users`, "select ?, ?, ? from users"},
+		{"number", "select * from users where id = 10 and score > 1.5e-3", "select * from users where id = ? and score > ?"},
+		{"list", "select * from users where id in (1, 2, 3)", "select * from users where id in (?, ?, ?)"},
+		{"placeholder", "select * from users where id = $1 and name = $2", "select * from users where id = $1 and name = $2"},
+		{"identifier with digits", "select col1 from t2", "select col1 from t2"},
+		{"quoted identifier", `select "user 1" from users`, `select "user 1" from users`},
+		{"dollar quoted", "select $$it's$$, $body$a $1 b$body$", "select ?, ?"},
+		{"line comment", "select 1 -- comment\nfrom users", "select ? from users"},
+		{"block comment", "select /* comment */ 1 /*app='api'*/", "select ?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, dbtx.Normalize(tt.query))
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package dbtx
+
+import "time"
+
+// Option configures the Atomic created by NewWithOptions.
+type Option interface {
+	apply(*config)
+}
+
+type config struct {
+	fns           []func(DBTX) DBTX
+	txTimeout     time.Duration
+	stats         bool
+	strictNesting bool
+	leaks         *leakDetector
+}
+
+type optionFunc func(*config)
+
+func (fn optionFunc) apply(c *config) {
+	fn(c)
+}
+
+// WithMiddleware wraps the DBTX with other implementations, such as Logger.
+// The middlewares are applied in the order they are passed, which is the same
+// as passing them to New.
+func WithMiddleware(fns ...func(DBTX) DBTX) Option {
+	return optionFunc(func(c *config) {
+		c.fns = append(c.fns, fns...)
+	})
+}
+
+// WithTxTimeout sets the maximum duration of a transaction started by RunInTx.
+// When the duration exceeded, the transaction is rolled back and the error
+// context.DeadlineExceeded is returned.
+// A shorter deadline in the context takes precedence.
+func WithTxTimeout(d time.Duration) Option {
+	return optionFunc(func(c *config) {
+		c.txTimeout = d
+	})
+}
+
+// WithStats enables the collection of transaction statistics, which can be
+// retrieved using StatsFromContext.
+func WithStats() Option {
+	return optionFunc(func(c *config) {
+		c.stats = true
+	})
+}
+
+// WithStrictNesting disallows RunInTx to be called with a context that
+// already contains a transaction. ErrNestedTransaction is returned instead of
+// reusing the existing transaction.
+func WithStrictNesting() Option {
+	return optionFunc(func(c *config) {
+		c.strictNesting = true
+	})
+}
+
+// WithLeakDetection detects the usage of transactions after RunInTx returns,
+// e.g. when the transaction context is passed to a goroutine.
+// Such usage returns ErrTxAlreadyClosed, and is reported by CheckLeaks.
+func WithLeakDetection() Option {
+	return optionFunc(func(c *config) {
+		c.leaks = new(leakDetector)
+	})
+}
+
+// WithLeakReporter is similar to WithLeakDetection, but also calls fn with
+// the error when the transaction is used after RunInTx returns, e.g. to log
+// the leak, or to panic in tests.
+func WithLeakReporter(fn func(error)) Option {
+	return optionFunc(func(c *config) {
+		c.leaks = &leakDetector{report: fn}
+	})
+}
@@ -0,0 +1,133 @@
+package oteltx
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/alextanhongpin/dbtx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ dbtx.DBTX = (*Tracer)(nil)
+
+// WithOtel returns a middleware that creates a span for each query.
+func WithOtel(tracer trace.Tracer) func(dbtx.DBTX) dbtx.DBTX {
+	return func(db dbtx.DBTX) dbtx.DBTX {
+		return NewTracer(db, tracer)
+	}
+}
+
+// Tracer creates a child span for each query.
+// The span is created from the context for the *Context methods, so that it
+// is nested under the caller's span.
+type Tracer struct {
+	dbtx dbtx.DBTX
+	t    trace.Tracer
+}
+
+func NewTracer(db dbtx.DBTX, t trace.Tracer) *Tracer {
+	return &Tracer{dbtx: db, t: t}
+}
+
+func (t *Tracer) Exec(query string, args ...any) (sql.Result, error) {
+	_, span := t.start(context.Background(), "Exec", query, args...)
+	defer span.End()
+
+	res, err := t.dbtx.Exec(query, args...)
+	record(span, err)
+
+	return res, err
+}
+
+func (t *Tracer) Prepare(query string) (*sql.Stmt, error) {
+	_, span := t.start(context.Background(), "Prepare", query)
+	defer span.End()
+
+	stmt, err := t.dbtx.Prepare(query)
+	record(span, err)
+
+	return stmt, err
+}
+
+func (t *Tracer) Query(query string, args ...any) (*sql.Rows, error) {
+	_, span := t.start(context.Background(), "Query", query, args...)
+	defer span.End()
+
+	rows, err := t.dbtx.Query(query, args...)
+	record(span, err)
+
+	return rows, err
+}
+
+func (t *Tracer) QueryRow(query string, args ...any) *sql.Row {
+	_, span := t.start(context.Background(), "QueryRow", query, args...)
+	defer span.End()
+
+	row := t.dbtx.QueryRow(query, args...)
+	record(span, row.Err())
+
+	return row
+}
+
+func (t *Tracer) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := t.start(ctx, "ExecContext", query, args...)
+	defer span.End()
+
+	res, err := t.dbtx.ExecContext(ctx, query, args...)
+	record(span, err)
+
+	return res, err
+}
+
+func (t *Tracer) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := t.start(ctx, "PrepareContext", query)
+	defer span.End()
+
+	stmt, err := t.dbtx.PrepareContext(ctx, query)
+	record(span, err)
+
+	return stmt, err
+}
+
+func (t *Tracer) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, "QueryContext", query, args...)
+	defer span.End()
+
+	rows, err := t.dbtx.QueryContext(ctx, query, args...)
+	record(span, err)
+
+	return rows, err
+}
+
+func (t *Tracer) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := t.start(ctx, "QueryRowContext", query, args...)
+	defer span.End()
+
+	row := t.dbtx.QueryRowContext(ctx, query, args...)
+	record(span, row.Err())
+
+	return row
+}
+
+func (t *Tracer) start(ctx context.Context, method, query string, args ...any) (context.Context, trace.Span) {
+	return t.t.Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.statement", query),
+			attribute.String("db.operation", method),
+			attribute.Int("db.args", len(args)),
+		),
+	)
+}
+
+func record(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+
+	span.SetStatus(codes.Ok, "")
+}
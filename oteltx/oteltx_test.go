@@ -0,0 +1,94 @@
+package oteltx_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/alextanhongpin/dbtx/dbtxmock"
+	"github.com/alextanhongpin/dbtx/oteltx"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var ErrBadQuery = errors.New("bad query")
+
+func TestWithOtel(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	tracer := tp.Tracer("test")
+
+	db := oteltx.WithOtel(tracer)(&dbtxmock.DB{
+		ExecFunc: func(ctx context.Context, query string, args ...any) (sql.Result, error) {
+			if query == `select invalid` {
+				return nil, ErrBadQuery
+			}
+
+			return dbtxmock.Result{}, nil
+		},
+	})
+
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	_, okErr := db.ExecContext(ctx, `select $1`, 1)
+	_, badErr := db.ExecContext(ctx, `select invalid`)
+	parent.End()
+
+	is := assert.New(t)
+	is.Nil(okErr)
+	is.ErrorIs(badErr, ErrBadQuery)
+
+	spans := sr.Ended()
+	is.Len(spans, 3)
+
+	t.Run("ok", func(t *testing.T) {
+		span := spans[0]
+
+		is := assert.New(t)
+		is.Equal("ExecContext", span.Name())
+		is.Equal(trace.SpanKindClient, span.SpanKind())
+		is.Equal(parent.SpanContext().SpanID(), span.Parent().SpanID())
+		is.ElementsMatch([]attribute.KeyValue{
+			attribute.String("db.statement", `select $1`),
+			attribute.String("db.operation", "ExecContext"),
+			attribute.Int("db.args", 1),
+		}, span.Attributes())
+		is.Equal(codes.Ok, span.Status().Code)
+		is.Empty(span.Events())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		span := spans[1]
+
+		is := assert.New(t)
+		is.Equal(codes.Error, span.Status().Code)
+		is.Equal(ErrBadQuery.Error(), span.Status().Description)
+
+		events := span.Events()
+		is.Len(events, 1)
+		is.Equal("exception", events[0].Name)
+	})
+}
+
+func TestQueryRow(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	db := oteltx.NewTracer(&dbtxmock.DB{
+		QueryRowFunc: func(ctx context.Context, query string, args ...any) *sql.Row {
+			return dbtxmock.ErrRow(ErrBadQuery)
+		},
+	}, tp.Tracer("test"))
+
+	is := assert.New(t)
+	is.ErrorIs(db.QueryRow(`select 1`).Err(), ErrBadQuery)
+
+	spans := sr.Ended()
+	is.Len(spans, 1)
+	is.Equal("QueryRow", spans[0].Name())
+	is.Equal(codes.Error, spans[0].Status().Code)
+}
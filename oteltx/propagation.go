@@ -0,0 +1,33 @@
+package oteltx
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Propagator propagates the trace context through the outbox, as the event
+// metadata. It implements outbox.Propagator.
+type Propagator struct {
+	p propagation.TextMapPropagator
+}
+
+// NewPropagator returns a Propagator that uses p, e.g.
+// otel.GetTextMapPropagator().
+func NewPropagator(p propagation.TextMapPropagator) *Propagator {
+	return &Propagator{p: p}
+}
+
+// Inject captures the trace context from the context as a map.
+func (p *Propagator) Inject(ctx context.Context) map[string]string {
+	carrier := make(propagation.MapCarrier)
+	p.p.Inject(ctx, carrier)
+
+	return carrier
+}
+
+// Extract returns the context with the trace context from the metadata, so
+// that the consumer continues the trace.
+func (p *Propagator) Extract(ctx context.Context, metadata map[string]string) context.Context {
+	return p.p.Extract(ctx, propagation.MapCarrier(metadata))
+}
@@ -0,0 +1,42 @@
+package oteltx_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alextanhongpin/dbtx/oteltx"
+	"github.com/alextanhongpin/dbtx/postgres/outbox"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ outbox.Propagator = (*oteltx.Propagator)(nil)
+
+func TestPropagator(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	ctx, span := tp.Tracer("test").Start(context.Background(), "producer")
+	defer span.End()
+
+	p := oteltx.NewPropagator(propagation.TraceContext{})
+	metadata := p.Inject(ctx)
+
+	is := assert.New(t)
+	is.Contains(metadata, "traceparent")
+
+	sc := trace.SpanContextFromContext(p.Extract(context.Background(), metadata))
+	is.True(sc.IsRemote())
+	is.Equal(span.SpanContext().TraceID(), sc.TraceID())
+	is.Equal(span.SpanContext().SpanID(), sc.SpanID())
+}
+
+func TestPropagatorEmpty(t *testing.T) {
+	p := oteltx.NewPropagator(propagation.TraceContext{})
+
+	is := assert.New(t)
+	is.Empty(p.Inject(context.Background()))
+
+	sc := trace.SpanContextFromContext(p.Extract(context.Background(), nil))
+	is.False(sc.IsValid())
+}
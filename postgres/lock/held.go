@@ -0,0 +1,86 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alextanhongpin/dbtx"
+)
+
+// HeldLock represents an advisory lock held by the current session.
+type HeldLock struct {
+	// Key is decoded from the pg_locks columns. The original string of keys
+	// created from NewStrKey and NewStrKeyPair cannot be recovered, only the
+	// hash.
+	Key *Key
+	// Shared is true if the lock is held in shared mode.
+	Shared bool
+	// Granted is false if the lock is still waiting to be acquired.
+	Granted bool
+}
+
+// Held returns the advisory locks held by the connection of the transaction in
+// the context, including session-level locks.
+// Postgres does not expose whether the lock is transaction or session-level
+// in pg_locks.
+// Held must be run within a transaction context.
+func Held(ctx context.Context) ([]HeldLock, error) {
+	tx, ok := dbtx.Value(ctx)
+	if !ok {
+		return nil, ErrLockOutsideTx
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT classid, objid, objsubid, mode, granted
+		FROM pg_locks
+		WHERE locktype = 'advisory'
+		AND pid = pg_backend_pid()
+		ORDER BY objsubid, classid, objid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locks []HeldLock
+	for rows.Next() {
+		var classID, objID uint32
+		var objSubID int
+		var mode string
+		var granted bool
+		if err := rows.Scan(&classID, &objID, &objSubID, &mode, &granted); err != nil {
+			return nil, err
+		}
+
+		key, err := decodeKey(classID, objID, objSubID)
+		if err != nil {
+			return nil, err
+		}
+
+		locks = append(locks, HeldLock{
+			Key:     key,
+			Shared:  mode == "ShareLock",
+			Granted: granted,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return locks, nil
+}
+
+// decodeKey decodes the key from the pg_locks columns.
+// For bigint keys, the high-order half is stored in classid, and the
+// low-order half in objid, with objsubid 1.
+// For int pair keys, the first key is stored in classid, and the second key
+// in objid, with objsubid 2.
+func decodeKey(classID, objID uint32, objSubID int) (*Key, error) {
+	switch objSubID {
+	case 1:
+		return NewIntKey(int64(uint64(classID)<<32 | uint64(objID))), nil
+	case 2:
+		return NewIntKeyPair(int32(classID), int32(objID)), nil
+	default:
+		return nil, fmt.Errorf("lock: unknown advisory lock objsubid %d", objSubID)
+	}
+}
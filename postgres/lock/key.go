@@ -1,8 +1,11 @@
 package lock
 
 import (
+	"cmp"
 	"fmt"
 	"hash/fnv"
+
+	"github.com/google/uuid"
 )
 
 // https://www.postgresql.org/docs/current/datatype-numeric.html
@@ -52,6 +55,38 @@ func (k *Key) String() string {
 	return k.repr
 }
 
+// Pair returns the pair of integers passed to the advisory lock functions.
+// Returns false if the key is not a pair key.
+func (k *Key) Pair() (int32, int32, bool) {
+	return k.x, k.y, k.pair
+}
+
+// Single returns the bigint passed to the advisory lock functions.
+// Returns false if the key is a pair key.
+func (k *Key) Single() (int64, bool) {
+	return k.z, !k.pair
+}
+
+// Compare returns -1, 0 or +1 depending on whether k is ordered before, the
+// same as, or after other.
+// Single keys are ordered before pair keys, since they are different lock
+// spaces in Postgres.
+func (k *Key) Compare(other *Key) int {
+	if k.pair != other.pair {
+		if k.pair {
+			return 1
+		}
+
+		return -1
+	}
+
+	if k.pair {
+		return cmp.Or(cmp.Compare(k.x, other.x), cmp.Compare(k.y, other.y))
+	}
+
+	return cmp.Compare(k.z, other.z)
+}
+
 func NewStrKey(z string) *Key {
 	c := Int64Hash(z)
 	return &Key{
@@ -70,6 +105,31 @@ func NewStrKeyPair(x, y string) *Key {
 	}
 }
 
+// NewUUIDKey returns the key from the hash of the uuid string, which is the
+// same as NewStrKey(id.String()).
+// The uuid is hashed to the 64-bit space, so there is a chance of collision.
+// By the birthday bound, the probability of any collision is roughly
+// n^2/2^65, e.g. about 1 in 37 million for 1 million distinct keys. A
+// collision only causes unrelated operations to wait for each other.
+func NewUUIDKey(id uuid.UUID) *Key {
+	s := id.String()
+	c := Int64Hash(s)
+	return &Key{
+		z:    c,
+		repr: fmt.Sprintf("Key(%s|%d)", s, c),
+	}
+}
+
+// NewBytesKey returns the key from the hash of the bytes.
+// Similar to NewUUIDKey, there is a chance of collision in the 64-bit space.
+func NewBytesKey(b []byte) *Key {
+	c := Int64Hash(string(b))
+	return &Key{
+		z:    c,
+		repr: fmt.Sprintf("Key(%x|%d)", b, c),
+	}
+}
+
 func Hash32(key string) uint32 {
 	hash := fnv.New32()
 	_, err := hash.Write([]byte(key))
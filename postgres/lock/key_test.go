@@ -2,9 +2,11 @@ package lock_test
 
 import (
 	"math"
+	"slices"
 	"testing"
 
 	"github.com/alextanhongpin/dbtx/postgres/lock"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,6 +19,68 @@ func TestKey(t *testing.T) {
 	is.Equal(`Key("foo"|1083137555, "bar"|513390112)`, lock.NewStrKeyPair("foo", "bar").String())
 }
 
+func TestKeyArgs(t *testing.T) {
+	is := assert.New(t)
+
+	z, ok := lock.NewStrKey("hello world").Single()
+	is.True(ok)
+	is.Equal(int64(9065573210506989167), z)
+
+	_, _, ok = lock.NewStrKey("hello world").Pair()
+	is.False(ok)
+
+	x, y, ok := lock.NewStrKeyPair("foo", "bar").Pair()
+	is.True(ok)
+	is.Equal(int32(1083137555), x)
+	is.Equal(int32(513390112), y)
+
+	_, ok = lock.NewStrKeyPair("foo", "bar").Single()
+	is.False(ok)
+}
+
+func TestKeyCompare(t *testing.T) {
+	keys := []*lock.Key{
+		lock.NewIntKeyPair(2, 1),
+		lock.NewIntKey(2),
+		lock.NewIntKeyPair(1, 2),
+		lock.NewIntKey(-1),
+		lock.NewIntKeyPair(1, 1),
+	}
+	slices.SortFunc(keys, (*lock.Key).Compare)
+
+	got := make([]string, len(keys))
+	for i, key := range keys {
+		got[i] = key.String()
+	}
+
+	is := assert.New(t)
+	is.Equal([]string{"Key(-1)", "Key(2)", "Key(1, 1)", "Key(1, 2)", "Key(2, 1)"}, got)
+	is.Equal(0, lock.NewStrKey("foo").Compare(lock.NewStrKey("foo")))
+}
+
+func TestUUIDKey(t *testing.T) {
+	is := assert.New(t)
+
+	id := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	key := lock.NewUUIDKey(id)
+	z, ok := key.Single()
+	is.True(ok)
+
+	want, _ := lock.NewStrKey(id.String()).Single()
+	is.Equal(want, z)
+	is.Equal(0, key.Compare(lock.NewUUIDKey(id)))
+	is.NotEqual(0, key.Compare(lock.NewUUIDKey(uuid.New())))
+}
+
+func TestBytesKey(t *testing.T) {
+	is := assert.New(t)
+
+	key := lock.NewBytesKey([]byte("hello world"))
+	is.Equal("Key(68656c6c6f20776f726c64|9065573210506989167)", key.String())
+	is.Equal(0, key.Compare(lock.NewStrKey("hello world")))
+	is.NotEqual(0, key.Compare(lock.NewBytesKey([]byte("hello"))))
+}
+
 func TestUint32ToInt32_Overflow(t *testing.T) {
 	i := uint32(math.MaxUint32)
 	is := assert.New(t)
@@ -5,13 +5,17 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/alextanhongpin/dbtx"
+	"github.com/alextanhongpin/dbtx/postgres/violations"
 )
 
 var (
 	ErrAlreadyLocked = errors.New("lock: key already locked")
-	ErrLockOutsideTx = errors.New("lock: cannot lock outside transaction")
+	ErrLockOutsideTx = fmt.Errorf("lock: cannot lock outside transaction: %w", dbtx.ErrNotTransaction)
+	ErrLockTimeout   = errors.New("lock: timeout acquiring lock")
 )
 
 type Locker struct {
@@ -46,24 +50,178 @@ func (l *Locker) TryLock(ctx context.Context, key *Key, fn func(context.Context)
 // will wait for the previous operation to complete.
 // Lock must be run within a transaction context, panics otherwise.
 func Lock(ctx context.Context, key *Key) error {
+	return lock(ctx, key, "pg_advisory_xact_lock")
+}
+
+// TryLock locks the given key. If multiple operations lock the same key, only
+// the first will succeed. The rest will fail with the error ErrAlreadyLocked.
+// TryLock must be run within a transaction context, panics otherwise.
+func TryLock(ctx context.Context, key *Key) error {
+	return tryLock(ctx, key, "pg_try_advisory_xact_lock")
+}
+
+// WithLock locks the given key, and runs the fn. The lock is released when the
+// transaction ends.
+// WithLock must be run within a transaction context.
+func WithLock(ctx context.Context, key *Key, fn func(context.Context) error) error {
+	if err := Lock(ctx, key); err != nil {
+		return err
+	}
+
+	return fn(ctx)
+}
+
+// WithSessionLock locks the given key for the session, and runs the fn. The
+// lock is released when fn returns, even if fn panics.
+// Similar to LockSession, conn must be a pinned connection.
+func WithSessionLock(ctx context.Context, conn conn, key *Key, fn func(context.Context) error) (err error) {
+	if err := LockSession(ctx, conn, key); err != nil {
+		return err
+	}
+	defer func() {
+		// Use a new context, since the lock must be released even if the
+		// context is cancelled.
+		_, unlockErr := Unlock(context.WithoutCancel(ctx), conn, key)
+		err = errors.Join(err, unlockErr)
+	}()
+
+	return fn(ctx)
+}
+
+// TryLockBool is similar to TryLock, but returns false instead of the error
+// ErrAlreadyLocked when the key is locked by another transaction.
+// The error is only returned when the query fails.
+func TryLockBool(ctx context.Context, key *Key) (bool, error) {
+	err := TryLock(ctx, key)
+	if errors.Is(err, ErrAlreadyLocked) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// LockShared locks the given key in shared mode. Multiple operations can hold
+// the shared lock of the same key, but it blocks the exclusive Lock until all
+// the shared locks are released, and vice versa.
+// LockShared must be run within a transaction context.
+func LockShared(ctx context.Context, key *Key) error {
+	return lock(ctx, key, "pg_advisory_xact_lock_shared")
+}
+
+// TryLockShared locks the given key in shared mode. It fails with the error
+// ErrAlreadyLocked if the key is locked exclusively.
+// TryLockShared must be run within a transaction context.
+func TryLockShared(ctx context.Context, key *Key) error {
+	return tryLock(ctx, key, "pg_try_advisory_xact_lock_shared")
+}
+
+// LockMany locks all the given keys. The keys are sorted before they are
+// locked, so that concurrent operations locking the same keys acquire them in
+// the same order, which prevents deadlock.
+// Returns on the first error.
+// LockMany must be run within a transaction context.
+func LockMany(ctx context.Context, keys ...*Key) error {
+	keys = slices.Clone(keys)
+	slices.SortFunc(keys, (*Key).Compare)
+
+	for _, key := range keys {
+		if err := Lock(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LockTimeout is similar to Lock, but fails with the error ErrLockTimeout if
+// the lock cannot be acquired within the given duration, or before the context
+// deadline, whichever is shorter.
+// The lock is acquired in a savepoint, since a failed statement aborts the
+// transaction. On failure, the savepoint is rolled back, so that the
+// transaction can still be used, e.g. to retry.
+// The lock_timeout is set using set_config, which only applies to the current
+// transaction, and is restored after the lock is acquired.
+// LockTimeout must be run within a transaction context.
+func LockTimeout(ctx context.Context, key *Key, d time.Duration) (err error) {
+	tx, ok := dbtx.Value(ctx)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrLockOutsideTx, key)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		d = min(d, time.Until(deadline))
+	}
+	// A lock_timeout of zero disables the timeout.
+	d = max(d, time.Millisecond)
+
+	var prev string
+	if err := tx.QueryRowContext(ctx, `SELECT current_setting('lock_timeout')`).Scan(&prev); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT lock_timeout`); err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		// Use a new context, since the savepoint must be rolled back even if
+		// the context is cancelled. This also restores the lock_timeout.
+		_, rbErr := tx.ExecContext(context.WithoutCancel(ctx), `ROLLBACK TO SAVEPOINT lock_timeout`)
+		err = errors.Join(err, rbErr)
+	}()
+
+	if err := setLockTimeout(ctx, tx, fmt.Sprintf("%dms", d.Milliseconds())); err != nil {
+		return err
+	}
+
+	if err := lock(ctx, key, "pg_advisory_xact_lock"); err != nil {
+		if violations.IsLockNotAvailable(err) {
+			return fmt.Errorf("%w: %s", ErrLockTimeout, key)
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("%w: %s: %w", ErrLockTimeout, key, ctxErr)
+		}
+
+		return err
+	}
+
+	if err := setLockTimeout(ctx, tx, prev); err != nil {
+		return err
+	}
+
+	// The transaction-level lock is kept after the savepoint is released.
+	_, err = tx.ExecContext(ctx, `RELEASE SAVEPOINT lock_timeout`)
+	return err
+}
+
+func setLockTimeout(ctx context.Context, tx dbtx.DBTX, timeout string) error {
+	// SET LOCAL does not accept parameters, use set_config instead.
+	_, err := tx.ExecContext(ctx, `SELECT set_config('lock_timeout', $1, true)`, timeout)
+	return err
+}
+
+func lock(ctx context.Context, key *Key, fn string) error {
 	tx, ok := dbtx.Value(ctx)
 	if !ok {
 		return fmt.Errorf("%w: %s", ErrLockOutsideTx, key)
 	}
 
 	if key.pair {
-		_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1, $2)`, key.x, key.y)
+		_, err := tx.ExecContext(ctx, `SELECT `+fn+`($1, $2)`, key.x, key.y)
 		return err
 	}
 
-	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, key.z)
+	_, err := tx.ExecContext(ctx, `SELECT `+fn+`($1)`, key.z)
 	return err
 }
 
-// TryLock locks the given key. If multiple operations lock the same key, only
-// the first will succeed. The rest will fail with the error ErrAlreadyLocked.
-// TryLock must be run within a transaction context, panics otherwise.
-func TryLock(ctx context.Context, key *Key) error {
+func tryLock(ctx context.Context, key *Key, fn string) error {
 	tx, ok := dbtx.Value(ctx)
 	if !ok {
 		return fmt.Errorf("%w: %s", ErrLockOutsideTx, key)
@@ -73,9 +231,9 @@ func TryLock(ctx context.Context, key *Key) error {
 	var isLockAcquired bool
 	var err error
 	if key.pair {
-		err = tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1, $2)`, key.x, key.y).Scan(&isLockAcquired)
+		err = tx.QueryRowContext(ctx, `SELECT `+fn+`($1, $2)`, key.x, key.y).Scan(&isLockAcquired)
 	} else {
-		err = tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, key.z).Scan(&isLockAcquired)
+		err = tx.QueryRowContext(ctx, `SELECT `+fn+`($1)`, key.z).Scan(&isLockAcquired)
 	}
 	if err != nil {
 		return err
@@ -87,3 +245,40 @@ func TryLock(ctx context.Context, key *Key) error {
 
 	return nil
 }
+
+// conn represents a connection that is pinned for the whole session, such as
+// *sql.Conn, or the DB of *dbtx.ConnAtomic.
+type conn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// LockSession locks the given key for the session. Unlike Lock, the lock is
+// not released when the transaction ends, and must be released by calling
+// Unlock on the same connection.
+// Session locks are scoped to the connection, so conn must be a pinned
+// connection, e.g. from dbtx.Atomic.Conn. Using a pool will release the lock
+// on a different connection.
+func LockSession(ctx context.Context, conn conn, key *Key) error {
+	if key.pair {
+		_, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1, $2)`, key.x, key.y)
+		return err
+	}
+
+	_, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, key.z)
+	return err
+}
+
+// Unlock releases the session lock for the given key.
+// Returns false if the lock was not held by the connection.
+func Unlock(ctx context.Context, conn conn, key *Key) (bool, error) {
+	var unlocked bool
+	var err error
+	if key.pair {
+		err = conn.QueryRowContext(ctx, `SELECT pg_advisory_unlock($1, $2)`, key.x, key.y).Scan(&unlocked)
+	} else {
+		err = conn.QueryRowContext(ctx, `SELECT pg_advisory_unlock($1)`, key.z).Scan(&unlocked)
+	}
+
+	return unlocked, err
+}
@@ -16,4 +16,10 @@ type Outbox struct {
 	Type          string
 	Payload       json.RawMessage
 	CreatedAt     time.Time
+	Attempts      int32
+	LastError     *string
+	NextAttemptAt time.Time
+	Status        string
+	ProcessedAt   *time.Time
+	Metadata      json.RawMessage
 }
@@ -9,9 +9,21 @@ import (
 )
 
 type Querier interface {
+	Claim(ctx context.Context) (*Outbox, error)
+	// ClaimOrdered claims the oldest event of an aggregate that is not claimed by
+	// other transactions. The aggregate is locked with an advisory lock, so that
+	// the events of the same aggregate are processed in order.
+	ClaimOrdered(ctx context.Context) (*Outbox, error)
 	Count(ctx context.Context) (int64, error)
 	Create(ctx context.Context, arg CreateParams) error
+	DeadLetter(ctx context.Context, arg DeadLetterParams) error
 	Delete(ctx context.Context) (*Outbox, error)
+	DeleteByID(ctx context.Context, id int64) error
+	Fail(ctx context.Context, arg FailParams) error
+	LoadDeadLetters(ctx context.Context) ([]*Outbox, error)
+	MarkProcessed(ctx context.Context, id int64) error
+	Prune(ctx context.Context, olderThan float64) (int64, error)
+	Requeue(ctx context.Context, ids []int64) error
 }
 
 var _ Querier = (*Queries)(nil)
@@ -11,9 +11,89 @@ import (
 	"github.com/lib/pq"
 )
 
+const claim = `-- name: Claim :one
+SELECT id, aggregate_id, aggregate_type, type, payload, created_at, attempts, last_error, next_attempt_at, status, processed_at, metadata
+FROM outbox
+WHERE status = 'pending'
+AND next_attempt_at <= now()
+ORDER BY next_attempt_at, id
+FOR UPDATE
+SKIP LOCKED
+LIMIT 1
+`
+
+func (q *Queries) Claim(ctx context.Context) (*Outbox, error) {
+	row := q.db.QueryRowContext(ctx, claim)
+	var i Outbox
+	err := row.Scan(
+		&i.ID,
+		&i.AggregateID,
+		&i.AggregateType,
+		&i.Type,
+		&i.Payload,
+		&i.CreatedAt,
+		&i.Attempts,
+		&i.LastError,
+		&i.NextAttemptAt,
+		&i.Status,
+		&i.ProcessedAt,
+		&i.Metadata,
+	)
+	return &i, err
+}
+
+const claimOrdered = `-- name: ClaimOrdered :one
+WITH heads AS MATERIALIZED (
+	SELECT DISTINCT ON (aggregate_type, aggregate_id) id, aggregate_type, aggregate_id, next_attempt_at
+	FROM outbox
+	WHERE status = 'pending'
+	ORDER BY aggregate_type, aggregate_id, id
+), candidates AS MATERIALIZED (
+	SELECT *
+	FROM heads
+	WHERE next_attempt_at <= now()
+	ORDER BY next_attempt_at, id
+)
+SELECT id, aggregate_id, aggregate_type, type, payload, created_at, attempts, last_error, next_attempt_at, status, processed_at, metadata
+FROM outbox
+WHERE id = (
+	SELECT id
+	FROM candidates
+	WHERE pg_try_advisory_xact_lock(hashtext('outbox'), hashtext(aggregate_type || ':' || aggregate_id))
+	LIMIT 1
+)
+AND status = 'pending'
+AND next_attempt_at <= now()
+FOR UPDATE
+`
+
+// ClaimOrdered claims the oldest event of an aggregate that is not claimed by
+// other transactions. The aggregate is locked with an advisory lock, so that
+// the events of the same aggregate are processed in order.
+func (q *Queries) ClaimOrdered(ctx context.Context) (*Outbox, error) {
+	row := q.db.QueryRowContext(ctx, claimOrdered)
+	var i Outbox
+	err := row.Scan(
+		&i.ID,
+		&i.AggregateID,
+		&i.AggregateType,
+		&i.Type,
+		&i.Payload,
+		&i.CreatedAt,
+		&i.Attempts,
+		&i.LastError,
+		&i.NextAttemptAt,
+		&i.Status,
+		&i.ProcessedAt,
+		&i.Metadata,
+	)
+	return &i, err
+}
+
 const count = `-- name: Count :one
 SELECT COUNT(*)
 FROM outbox
+WHERE status = 'pending'
 `
 
 func (q *Queries) Count(ctx context.Context) (int64, error) {
@@ -28,12 +108,14 @@ INSERT INTO outbox (
 	aggregate_id,
 	aggregate_type,
 	type,
-	payload
+	payload,
+	metadata
 ) VALUES (
 	UNNEST($1::text[]),
 	UNNEST($2::text[]),
 	UNNEST($3::text[]),
-	UNNEST($4::text[])::jsonb
+	UNNEST($4::text[])::jsonb,
+	UNNEST($5::text[])::jsonb
 )
 `
 
@@ -42,6 +124,7 @@ type CreateParams struct {
 	AggregateTypes []string
 	Types          []string
 	Payloads       []string
+	Metadata       []string
 }
 
 func (q *Queries) Create(ctx context.Context, arg CreateParams) error {
@@ -50,21 +133,42 @@ func (q *Queries) Create(ctx context.Context, arg CreateParams) error {
 		pq.Array(arg.AggregateTypes),
 		pq.Array(arg.Types),
 		pq.Array(arg.Payloads),
+		pq.Array(arg.Metadata),
 	)
 	return err
 }
 
+const deadLetter = `-- name: DeadLetter :exec
+UPDATE outbox
+SET status = 'dead',
+	attempts = attempts + 1,
+	last_error = $1::text
+WHERE id = $2
+`
+
+type DeadLetterParams struct {
+	LastError string
+	ID        int64
+}
+
+func (q *Queries) DeadLetter(ctx context.Context, arg DeadLetterParams) error {
+	_, err := q.db.ExecContext(ctx, deadLetter, arg.LastError, arg.ID)
+	return err
+}
+
 const delete = `-- name: Delete :one
 DELETE FROM outbox
 WHERE id = (
 	SELECT id
 	FROM outbox
-	ORDER BY id
+	WHERE status = 'pending'
+	AND next_attempt_at <= now()
+	ORDER BY next_attempt_at, id
 	FOR UPDATE
 	SKIP LOCKED
 	LIMIT 1
 )
-RETURNING id, aggregate_id, aggregate_type, type, payload, created_at
+RETURNING id, aggregate_id, aggregate_type, type, payload, created_at, attempts, last_error, next_attempt_at, status, processed_at, metadata
 `
 
 func (q *Queries) Delete(ctx context.Context) (*Outbox, error) {
@@ -77,6 +181,125 @@ func (q *Queries) Delete(ctx context.Context) (*Outbox, error) {
 		&i.Type,
 		&i.Payload,
 		&i.CreatedAt,
+		&i.Attempts,
+		&i.LastError,
+		&i.NextAttemptAt,
+		&i.Status,
+		&i.ProcessedAt,
+		&i.Metadata,
 	)
 	return &i, err
 }
+
+const deleteByID = `-- name: DeleteByID :exec
+DELETE FROM outbox
+WHERE id = $1
+`
+
+func (q *Queries) DeleteByID(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteByID, id)
+	return err
+}
+
+const fail = `-- name: Fail :exec
+UPDATE outbox
+SET attempts = attempts + 1,
+	last_error = $1::text,
+	next_attempt_at = now() + make_interval(secs => $2::float8)
+WHERE id = $3
+`
+
+type FailParams struct {
+	LastError string
+	Backoff   float64
+	ID        int64
+}
+
+func (q *Queries) Fail(ctx context.Context, arg FailParams) error {
+	_, err := q.db.ExecContext(ctx, fail, arg.LastError, arg.Backoff, arg.ID)
+	return err
+}
+
+const loadDeadLetters = `-- name: LoadDeadLetters :many
+SELECT id, aggregate_id, aggregate_type, type, payload, created_at, attempts, last_error, next_attempt_at, status, processed_at, metadata
+FROM outbox
+WHERE status = 'dead'
+ORDER BY id
+`
+
+func (q *Queries) LoadDeadLetters(ctx context.Context) ([]*Outbox, error) {
+	rows, err := q.db.QueryContext(ctx, loadDeadLetters)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*Outbox{}
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.AggregateID,
+			&i.AggregateType,
+			&i.Type,
+			&i.Payload,
+			&i.CreatedAt,
+			&i.Attempts,
+			&i.LastError,
+			&i.NextAttemptAt,
+			&i.Status,
+			&i.ProcessedAt,
+			&i.Metadata,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markProcessed = `-- name: MarkProcessed :exec
+UPDATE outbox
+SET status = 'processed',
+	processed_at = now()
+WHERE id = $1
+`
+
+func (q *Queries) MarkProcessed(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, markProcessed, id)
+	return err
+}
+
+const prune = `-- name: Prune :execrows
+DELETE FROM outbox
+WHERE status = 'processed'
+AND processed_at < now() - make_interval(secs => $1::float8)
+`
+
+func (q *Queries) Prune(ctx context.Context, olderThan float64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, prune, olderThan)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const requeue = `-- name: Requeue :exec
+UPDATE outbox
+SET status = 'pending',
+	attempts = 0,
+	last_error = NULL,
+	next_attempt_at = now()
+WHERE status = 'dead'
+AND id = ANY($1::bigint[])
+`
+
+func (q *Queries) Requeue(ctx context.Context, ids []int64) error {
+	_, err := q.db.ExecContext(ctx, requeue, pq.Array(ids))
+	return err
+}
@@ -3,12 +3,14 @@ INSERT INTO outbox (
 	aggregate_id,
 	aggregate_type,
 	type,
-	payload
+	payload,
+	metadata
 ) VALUES (
 	UNNEST(@aggregate_ids::text[]),
 	UNNEST(@aggregate_types::text[]),
 	UNNEST(@types::text[]),
-	UNNEST(@payloads::text[])::jsonb
+	UNNEST(@payloads::text[])::jsonb,
+	UNNEST(@metadata::text[])::jsonb
 );
 
 -- name: Delete :one
@@ -16,13 +18,97 @@ DELETE FROM outbox
 WHERE id = (
 	SELECT id
 	FROM outbox
-	ORDER BY id
+	WHERE status = 'pending'
+	AND next_attempt_at <= now()
+	ORDER BY next_attempt_at, id
 	FOR UPDATE
 	SKIP LOCKED
 	LIMIT 1
 )
 RETURNING *;
 
+-- name: Claim :one
+SELECT *
+FROM outbox
+WHERE status = 'pending'
+AND next_attempt_at <= now()
+ORDER BY next_attempt_at, id
+FOR UPDATE
+SKIP LOCKED
+LIMIT 1;
+
+-- name: ClaimOrdered :one
+-- ClaimOrdered claims the oldest event of an aggregate that is not claimed by
+-- other transactions. The aggregate is locked with an advisory lock, so that
+-- the events of the same aggregate are processed in order.
+WITH heads AS MATERIALIZED (
+	SELECT DISTINCT ON (aggregate_type, aggregate_id) id, aggregate_type, aggregate_id, next_attempt_at
+	FROM outbox
+	WHERE status = 'pending'
+	ORDER BY aggregate_type, aggregate_id, id
+), candidates AS MATERIALIZED (
+	SELECT *
+	FROM heads
+	WHERE next_attempt_at <= now()
+	ORDER BY next_attempt_at, id
+)
+SELECT *
+FROM outbox
+WHERE id = (
+	SELECT id
+	FROM candidates
+	WHERE pg_try_advisory_xact_lock(hashtext('outbox'), hashtext(aggregate_type || ':' || aggregate_id))
+	LIMIT 1
+)
+AND status = 'pending'
+AND next_attempt_at <= now()
+FOR UPDATE;
+
+-- name: DeleteByID :exec
+DELETE FROM outbox
+WHERE id = @id;
+
+-- name: Fail :exec
+UPDATE outbox
+SET attempts = attempts + 1,
+	last_error = @last_error::text,
+	next_attempt_at = now() + make_interval(secs => @backoff::float8)
+WHERE id = @id;
+
+-- name: DeadLetter :exec
+UPDATE outbox
+SET status = 'dead',
+	attempts = attempts + 1,
+	last_error = @last_error::text
+WHERE id = @id;
+
+-- name: LoadDeadLetters :many
+SELECT *
+FROM outbox
+WHERE status = 'dead'
+ORDER BY id;
+
+-- name: Requeue :exec
+UPDATE outbox
+SET status = 'pending',
+	attempts = 0,
+	last_error = NULL,
+	next_attempt_at = now()
+WHERE status = 'dead'
+AND id = ANY(@ids::bigint[]);
+
+-- name: MarkProcessed :exec
+UPDATE outbox
+SET status = 'processed',
+	processed_at = now()
+WHERE id = @id;
+
+-- name: Prune :execrows
+DELETE FROM outbox
+WHERE status = 'processed'
+AND processed_at < now() - make_interval(secs => @older_than::float8);
+
 -- name: Count :one
 SELECT COUNT(*)
-FROM outbox;
+FROM outbox
+WHERE status = 'pending';
@@ -5,5 +5,20 @@ CREATE TABLE outbox (
 	type text NOT NULL,
 	payload jsonb NOT NULL DEFAULT '{}',
 	created_at timestamptz NOT NULL DEFAULT now(),
+	attempts int NOT NULL DEFAULT 0,
+	last_error text,
+	next_attempt_at timestamptz NOT NULL DEFAULT now(),
+	status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'processed', 'dead')),
+	processed_at timestamptz,
+	metadata jsonb NOT NULL DEFAULT '{}',
 	PRIMARY KEY (id)
 );
+
+CREATE INDEX outbox_next_attempt_at_idx ON outbox (next_attempt_at, id)
+WHERE status = 'pending';
+
+CREATE INDEX outbox_processed_at_idx ON outbox (processed_at)
+WHERE status = 'processed';
+
+CREATE INDEX outbox_aggregate_idx ON outbox (aggregate_type, aggregate_id, id)
+WHERE status = 'pending';
@@ -0,0 +1,11 @@
+CREATE OR REPLACE FUNCTION outbox_notify() RETURNS trigger AS $$
+BEGIN
+	PERFORM pg_notify('outbox', '');
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER outbox_notify
+AFTER INSERT ON outbox
+FOR EACH STATEMENT
+EXECUTE FUNCTION outbox_notify();
@@ -0,0 +1,18 @@
+-- Upgrades the outbox table created before the retry, dead-letter, retention
+-- and metadata columns were added. Safe to run more than once.
+ALTER TABLE outbox
+	ADD COLUMN IF NOT EXISTS attempts int NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS last_error text,
+	ADD COLUMN IF NOT EXISTS next_attempt_at timestamptz NOT NULL DEFAULT now(),
+	ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'processed', 'dead')),
+	ADD COLUMN IF NOT EXISTS processed_at timestamptz,
+	ADD COLUMN IF NOT EXISTS metadata jsonb NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS outbox_next_attempt_at_idx ON outbox (next_attempt_at, id)
+WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS outbox_processed_at_idx ON outbox (processed_at)
+WHERE status = 'processed';
+
+CREATE INDEX IF NOT EXISTS outbox_aggregate_idx ON outbox (aggregate_type, aggregate_id, id)
+WHERE status = 'pending';
@@ -0,0 +1,121 @@
+// Package kafka implements the outbox flusher that publishes the events to
+// Kafka.
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/alextanhongpin/dbtx/postgres/outbox"
+	"github.com/segmentio/kafka-go"
+)
+
+// TypeHeader is the message header that contains the event type.
+const TypeHeader = "type"
+
+// Writer is implemented by *kafka.Writer.
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// Flusher publishes the outbox events to Kafka.
+// Each event is published to the topic of the AggregateType, with the
+// AggregateID as the key, so that the events of the same aggregate are
+// published to the same partition in order. The event metadata is published
+// as the message headers.
+type Flusher struct {
+	writer Writer
+	topic  func(outbox.Event) string
+}
+
+// Option configures the Flusher.
+type Option func(*Flusher)
+
+// WithTopic sets the fn that maps the event to the topic.
+// Defaults to the AggregateType.
+func WithTopic(fn func(outbox.Event) string) Option {
+	return func(f *Flusher) {
+		f.topic = fn
+	}
+}
+
+// New returns a Flusher that publishes the events using the writer, usually a
+// *kafka.Writer.
+// The writer must not set the Topic, since the topic is set per message. Use
+// a key based balancer, such as kafka.Hash, to preserve the ordering.
+func New(w Writer, opts ...Option) *Flusher {
+	f := &Flusher{
+		writer: w,
+		topic: func(evt outbox.Event) string {
+			return evt.AggregateType
+		},
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+// Flush publishes the events. If only some of the events fail to be
+// published, a *FlushError is returned with the failed events.
+func (f *Flusher) Flush(ctx context.Context, events []outbox.Event) error {
+	msgs := make([]kafka.Message, len(events))
+	for i, evt := range events {
+		headers := []kafka.Header{
+			{Key: TypeHeader, Value: []byte(evt.Type)},
+		}
+		// The metadata, such as the trace context, is propagated as headers.
+		// The event type takes precedence over a metadata key of the same name.
+		for _, k := range slices.Sorted(maps.Keys(evt.Metadata)) {
+			if k == TypeHeader {
+				continue
+			}
+
+			headers = append(headers, kafka.Header{Key: k, Value: []byte(evt.Metadata[k])})
+		}
+
+		msgs[i] = kafka.Message{
+			Topic:   f.topic(evt),
+			Key:     []byte(evt.AggregateID),
+			Value:   evt.Payload,
+			Headers: headers,
+		}
+	}
+
+	err := f.writer.WriteMessages(ctx, msgs...)
+
+	var werrs kafka.WriteErrors
+	if errors.As(err, &werrs) {
+		ferr := new(FlushError)
+		for i, err := range werrs {
+			if err != nil {
+				ferr.Events = append(ferr.Events, events[i])
+				ferr.Errs = append(ferr.Errs, err)
+			}
+		}
+
+		return ferr
+	}
+
+	return err
+}
+
+// FlushError is returned when some of the events fail to be published.
+type FlushError struct {
+	// Events are the events that failed to be published.
+	Events []outbox.Event
+	// Errs are the errors for the events, in the same order.
+	Errs []error
+}
+
+func (e *FlushError) Error() string {
+	return fmt.Sprintf("kafka: failed to publish %d events: %v", len(e.Events), errors.Join(e.Errs...))
+}
+
+func (e *FlushError) Unwrap() []error {
+	return e.Errs
+}
@@ -0,0 +1,107 @@
+package kafka_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/alextanhongpin/dbtx/postgres/outbox"
+	"github.com/alextanhongpin/dbtx/postgres/outbox/kafka"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+var ErrWrite = errors.New("write failed")
+
+type writerStub struct {
+	msgs []kafkago.Message
+	err  error
+}
+
+func (w *writerStub) WriteMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	w.msgs = append(w.msgs, msgs...)
+
+	return w.err
+}
+
+func TestFlush(t *testing.T) {
+	w := new(writerStub)
+	f := kafka.New(w)
+
+	err := f.Flush(context.Background(), []outbox.Event{
+		{
+			AggregateID:   "1",
+			AggregateType: "user",
+			Type:          "user_created",
+			Payload:       json.RawMessage(`{"name":"john"}`),
+			Metadata: map[string]string{
+				"traceparent": "00-trace",
+				"baggage":     "k=v",
+				// Does not override the event type.
+				kafka.TypeHeader: "other",
+			},
+		},
+	})
+
+	is := assert.New(t)
+	is.Nil(err)
+	is.Equal([]kafkago.Message{
+		{
+			Topic: "user",
+			Key:   []byte("1"),
+			Value: []byte(`{"name":"john"}`),
+			Headers: []kafkago.Header{
+				{Key: kafka.TypeHeader, Value: []byte("user_created")},
+				{Key: "baggage", Value: []byte("k=v")},
+				{Key: "traceparent", Value: []byte("00-trace")},
+			},
+		},
+	}, w.msgs)
+}
+
+func TestFlushWithTopic(t *testing.T) {
+	w := new(writerStub)
+	f := kafka.New(w, kafka.WithTopic(func(evt outbox.Event) string {
+		return "events." + evt.AggregateType
+	}))
+
+	is := assert.New(t)
+	is.Nil(f.Flush(context.Background(), []outbox.Event{{AggregateType: "user"}}))
+	is.Len(w.msgs, 1)
+	is.Equal("events.user", w.msgs[0].Topic)
+}
+
+func TestFlushError(t *testing.T) {
+	events := []outbox.Event{
+		{ID: 1, AggregateType: "user"},
+		{ID: 2, AggregateType: "user"},
+		{ID: 3, AggregateType: "user"},
+	}
+
+	t.Run("partial", func(t *testing.T) {
+		f := kafka.New(&writerStub{
+			err: kafkago.WriteErrors{nil, ErrWrite, nil},
+		})
+
+		err := f.Flush(context.Background(), events)
+
+		var ferr *kafka.FlushError
+		is := assert.New(t)
+		is.ErrorAs(err, &ferr)
+		is.ErrorIs(err, ErrWrite)
+		is.Equal([]outbox.Event{events[1]}, ferr.Events)
+		is.Equal([]error{ErrWrite}, ferr.Errs)
+	})
+
+	t.Run("all", func(t *testing.T) {
+		f := kafka.New(&writerStub{err: ErrWrite})
+
+		err := f.Flush(context.Background(), events)
+
+		var ferr *kafka.FlushError
+		is := assert.New(t)
+		is.ErrorIs(err, ErrWrite)
+		is.False(errors.As(err, &ferr))
+	})
+}
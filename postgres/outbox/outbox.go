@@ -1,10 +1,19 @@
+// Package outbox implements the transactional outbox pattern on Postgres.
+//
+// New installations create the table from internal/schema.sql. Existing
+// tables created before the attempts, last_error, next_attempt_at, status,
+// processed_at and metadata columns were added must be upgraded with Upgrade
+// before running the new version, since the queries depend on them.
 package outbox
 
 import (
 	"context"
 	"database/sql"
+	_ "embed"
 	"encoding/json"
 	"errors"
+	"maps"
+	"slices"
 	"sync"
 	"time"
 
@@ -14,10 +23,20 @@ import (
 
 var Empty = errors.New("outbox: empty")
 
+// Channel is the channel that is notified when new events are inserted.
+const Channel = "outbox"
+
+//go:embed internal/trigger.sql
+var trigger string
+
+//go:embed internal/upgrade.sql
+var upgrade string
+
 var outboxContextKey contextKey = "outbox"
 
 type Outbox struct {
 	*dbtx.Atomic
+	metadata func(context.Context) map[string]string
 }
 
 //go:generate sqlc -f internal/sqlc.yaml generate
@@ -32,20 +51,55 @@ func New(db *sql.DB, fns ...func(dbtx.DBTX) dbtx.DBTX) *Outbox {
 // Use a separate background job to process the outbox messages.
 func (o *Outbox) RunInTx(ctx context.Context, fn func(context.Context) error) error {
 	return o.Atomic.RunInTx(ctx, func(txCtx context.Context) error {
-		ob := new(outbox)
+		ob := &outbox{metadata: o.metadata}
 		if err := fn(outboxContextKey.WithValue(txCtx, ob)); err != nil {
 			return err
 		}
 
 		// Write events.
 		if !ob.IsZero() {
-			return o.db(txCtx).Create(txCtx, ob.Params())
+			params, err := ob.Params()
+			if err != nil {
+				return err
+			}
+
+			return o.db(txCtx).Create(txCtx, params)
 		}
 
 		return nil
 	})
 }
 
+// WithMetadata returns a copy of the Outbox that captures the metadata from
+// the context when the messages are enqueued, e.g. the tenant. The metadata
+// is stored with the event, so that the flusher can publish it as headers.
+func (o *Outbox) WithMetadata(fn func(context.Context) map[string]string) *Outbox {
+	return &Outbox{
+		Atomic:   o.Atomic,
+		metadata: fn,
+	}
+}
+
+// Propagator captures the context, such as the trace context, as metadata,
+// and restores it from the metadata. Use oteltx.NewPropagator for
+// OpenTelemetry.
+type Propagator interface {
+	Inject(ctx context.Context) map[string]string
+	Extract(ctx context.Context, metadata map[string]string) context.Context
+}
+
+// WithPropagator returns a copy of the Outbox that captures the context with
+// the propagator when the messages are enqueued, e.g. the trace context.
+func (o *Outbox) WithPropagator(p Propagator) *Outbox {
+	return o.WithMetadata(p.Inject)
+}
+
+// Extract returns the context restored by the propagator from the event
+// metadata, so that the consumer continues the trace.
+func Extract(ctx context.Context, p Propagator, evt Event) context.Context {
+	return p.Extract(ctx, evt.Metadata)
+}
+
 // Count return the number of outbox messages.
 func (o *Outbox) Count(ctx context.Context) (int64, error) {
 	return o.db(ctx).Count(ctx)
@@ -62,17 +116,62 @@ func (o *Outbox) Process(ctx context.Context, fn func(context.Context, Event) er
 			return err
 		}
 
-		return fn(txCtx, Event{
-			ID:            e.ID,
-			AggregateID:   e.AggregateID,
-			AggregateType: e.AggregateType,
-			Payload:       e.Payload,
-			Type:          e.Type,
-			CreatedAt:     e.CreatedAt,
-		})
+		evt, err := newEvent(e)
+		if err != nil {
+			return err
+		}
+
+		return fn(txCtx, evt)
 	})
 }
 
+// LoadDeadLetters returns the events that are dead-lettered after exceeding
+// the max attempts.
+func (o *Outbox) LoadDeadLetters(ctx context.Context) ([]Event, error) {
+	rows, err := o.db(ctx).LoadDeadLetters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, len(rows))
+	for i, row := range rows {
+		events[i], err = newEvent(row)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
+
+// Requeue resets the attempts of the dead-lettered events, so that they are
+// processed again.
+func (o *Outbox) Requeue(ctx context.Context, ids ...int64) error {
+	return o.db(ctx).Requeue(ctx, ids)
+}
+
+// Prune deletes the processed events that are older than the given duration.
+// Only applicable when the events are retained with WithRetention.
+// Returns the number of deleted events.
+func (o *Outbox) Prune(ctx context.Context, olderThan time.Duration) (int64, error) {
+	return o.db(ctx).Prune(ctx, olderThan.Seconds())
+}
+
+// InstallTrigger creates the trigger that notifies the Channel when new events
+// are inserted. This is required by the relay WithListener.
+func InstallTrigger(ctx context.Context, db dbtx.DBTX) error {
+	_, err := db.ExecContext(ctx, trigger)
+	return err
+}
+
+// Upgrade adds the columns and indexes that are missing from an outbox table
+// created by an earlier version. The existing events are kept as pending, with
+// no attempts. It is idempotent, and a no-op for an up-to-date table.
+func Upgrade(ctx context.Context, db dbtx.DBTX) error {
+	_, err := db.ExecContext(ctx, upgrade)
+	return err
+}
+
 func (o *Outbox) db(ctx context.Context) postgres.Querier {
 	return postgres.New(o.Atomic.DBTx(ctx))
 }
@@ -83,6 +182,9 @@ type Message struct {
 	AggregateType string
 	Payload       json.RawMessage
 	Type          string
+	// Metadata is merged with the metadata captured from the context, and
+	// takes precedence.
+	Metadata map[string]string
 }
 
 // Event is the enqueued message.
@@ -93,14 +195,53 @@ type Event struct {
 	Payload       json.RawMessage
 	Type          string
 	CreatedAt     time.Time
+	// Attempts is the number of failed attempts to publish the event.
+	Attempts int
+	// LastError is the error of the last failed attempt.
+	LastError string
+	// Metadata is the metadata captured when the message is enqueued.
+	Metadata map[string]string
+}
+
+func newEvent(e *postgres.Outbox) (Event, error) {
+	var lastError string
+	if e.LastError != nil {
+		lastError = *e.LastError
+	}
+
+	var metadata map[string]string
+	if err := json.Unmarshal(e.Metadata, &metadata); err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		ID:            e.ID,
+		AggregateID:   e.AggregateID,
+		AggregateType: e.AggregateType,
+		Payload:       e.Payload,
+		Type:          e.Type,
+		CreatedAt:     e.CreatedAt,
+		Attempts:      int(e.Attempts),
+		LastError:     lastError,
+		Metadata:      metadata,
+	}, nil
 }
 
 type outbox struct {
-	mu   sync.RWMutex
-	msgs []Message
+	mu       sync.RWMutex
+	msgs     []Message
+	metadata func(context.Context) map[string]string
 }
 
-func (o *outbox) Enqueue(msgs ...Message) {
+func (o *outbox) Enqueue(ctx context.Context, msgs ...Message) {
+	if o.metadata != nil {
+		md := o.metadata(ctx)
+		msgs = slices.Clone(msgs)
+		for i, msg := range msgs {
+			msgs[i].Metadata = merge(md, msg.Metadata)
+		}
+	}
+
 	o.mu.Lock()
 	o.msgs = append(o.msgs, msgs...)
 	o.mu.Unlock()
@@ -114,24 +255,45 @@ func (o *outbox) IsZero() bool {
 	return isZero
 }
 
-func (o *outbox) Params() (params postgres.CreateParams) {
+func (o *outbox) Params() (params postgres.CreateParams, err error) {
 	o.mu.RLock()
+	defer o.mu.RUnlock()
+
 	for _, msg := range o.msgs {
+		md := msg.Metadata
+		if md == nil {
+			md = make(map[string]string)
+		}
+		b, err := json.Marshal(md)
+		if err != nil {
+			return params, err
+		}
+
+		params.Metadata = append(params.Metadata, string(b))
 		params.AggregateIds = append(params.AggregateIds, msg.AggregateID)
 		params.AggregateTypes = append(params.AggregateTypes, msg.AggregateType)
 		params.Payloads = append(params.Payloads, string(msg.Payload))
 		params.Types = append(params.Types, msg.Type)
 	}
-	o.mu.RUnlock()
 
-	return
+	return params, nil
+}
+
+// merge returns a new map with the entries from both maps. The entries in b
+// takes precedence.
+func merge(a, b map[string]string) map[string]string {
+	m := make(map[string]string, len(a)+len(b))
+	maps.Copy(m, a)
+	maps.Copy(m, b)
+
+	return m
 }
 
 // Enqueue enqueues the events to the outbox.
 func Enqueue(ctx context.Context, msgs ...Message) bool {
 	o, ok := outboxContextKey.Value(ctx)
 	if ok {
-		o.Enqueue(msgs...)
+		o.Enqueue(ctx, msgs...)
 	}
 
 	return ok
@@ -5,13 +5,23 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	_ "embed"
 
 	"github.com/alextanhongpin/core/storage/pg/pgtest"
 	"github.com/alextanhongpin/dbtx"
 	"github.com/alextanhongpin/dbtx/postgres/outbox"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -23,8 +33,11 @@ const postgresVersion = "postgres:15.1-alpine"
 var schema string
 
 func migrate(db *sql.DB) error {
-	_, err := db.Exec(schema)
-	return err
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+
+	return outbox.InstallTrigger(context.Background(), db)
 }
 
 func TestMain(m *testing.M) {
@@ -34,9 +47,52 @@ func TestMain(m *testing.M) {
 	m.Run()
 }
 
+// newDB returns the db with an empty outbox table, so that the events left by
+// other tests do not affect the assertions.
+func newDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db := pgtest.DB(t)
+	if _, err := db.Exec(`TRUNCATE outbox`); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// runRelay runs the relay in the background, and returns the fn that stops
+// the relay and waits for it to return.
+func runRelay(t *testing.T, relay *outbox.Relay) (stop func()) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- relay.Run(ctx)
+	}()
+
+	stop = sync.OnceFunc(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+	t.Cleanup(stop)
+
+	return stop
+}
+
+// isEmpty reports whether there are no pending events.
+func isEmpty(ob *outbox.Outbox) func() bool {
+	return func() bool {
+		n, err := ob.Count(context.Background())
+		return err == nil && n == 0
+	}
+}
+
 func TestOutbox(t *testing.T) {
 	is := assert.New(t)
-	ob := outbox.New(pgtest.DB(t))
+	ob := outbox.New(newDB(t))
 	ctx := context.Background()
 	err := ob.RunInTx(ctx, func(txCtx context.Context) error {
 		ok := outbox.Enqueue(txCtx,
@@ -101,3 +157,491 @@ func TestOutbox(t *testing.T) {
 		is.ErrorIs(err, outbox.Empty)
 	})
 }
+
+func TestRelay(t *testing.T) {
+	is := assert.New(t)
+	ob := outbox.New(newDB(t))
+	ctx := context.Background()
+
+	err := ob.RunInTx(ctx, func(txCtx context.Context) error {
+		is.True(outbox.Enqueue(txCtx,
+			outbox.Message{
+				AggregateID:   "a-id-1",
+				AggregateType: "a-type-1",
+				Type:          "type-1",
+				Payload:       json.RawMessage(`{}`),
+			},
+			outbox.Message{
+				AggregateID:   "a-id-2",
+				AggregateType: "a-type-2",
+				Type:          "type-2",
+				Payload:       json.RawMessage(`{}`),
+			},
+		))
+
+		return nil
+	})
+	is.Nil(err)
+
+	f := &mockFlusher{}
+	relay := outbox.NewRelay(ob, f, outbox.WithPollInterval(10*time.Millisecond))
+
+	stop := runRelay(t, relay)
+	is.Eventually(isEmpty(ob), time.Second, 10*time.Millisecond)
+	stop()
+
+	is.Len(f.events, 2)
+	is.Equal("type-1", f.events[0].Type)
+	is.Equal("type-2", f.events[1].Type)
+}
+
+type mockFlusher struct {
+	mu     sync.Mutex
+	events []outbox.Event
+}
+
+func (m *mockFlusher) Flush(ctx context.Context, events []outbox.Event) error {
+	m.mu.Lock()
+	m.events = append(m.events, events...)
+	m.mu.Unlock()
+
+	return nil
+}
+
+func TestRelayBackoff(t *testing.T) {
+	is := assert.New(t)
+	ob := outbox.New(newDB(t))
+	ctx := context.Background()
+
+	err := ob.RunInTx(ctx, func(txCtx context.Context) error {
+		is.True(outbox.Enqueue(txCtx, outbox.Message{
+			AggregateID:   "a-id-1",
+			AggregateType: "a-type-1",
+			Type:          "type-1",
+			Payload:       json.RawMessage(`{}`),
+		}))
+
+		return nil
+	})
+	is.Nil(err)
+
+	f := &failingFlusher{failures: 2}
+	relay := outbox.NewRelay(ob, f,
+		outbox.WithPollInterval(10*time.Millisecond),
+		outbox.WithBackoff(func(attempt int) time.Duration {
+			return 0
+		}),
+	)
+
+	stop := runRelay(t, relay)
+	is.Eventually(isEmpty(ob), time.Second, 10*time.Millisecond)
+	stop()
+
+	is.Equal([]int{0, 1, 2}, f.attempts)
+}
+
+type failingFlusher struct {
+	failures int
+	attempts []int
+}
+
+func (f *failingFlusher) Flush(ctx context.Context, events []outbox.Event) error {
+	for _, evt := range events {
+		f.attempts = append(f.attempts, evt.Attempts)
+	}
+	if len(f.attempts) <= f.failures {
+		return errors.New("broker unavailable")
+	}
+
+	return nil
+}
+
+func TestRelayProcessTimeout(t *testing.T) {
+	is := assert.New(t)
+	ob := outbox.New(newDB(t))
+	ctx := context.Background()
+
+	err := ob.RunInTx(ctx, func(txCtx context.Context) error {
+		is.True(outbox.Enqueue(txCtx, outbox.Message{
+			AggregateID:   "a-id-1",
+			AggregateType: "a-type-1",
+			Type:          "type-1",
+			Payload:       json.RawMessage(`{}`),
+		}))
+
+		return nil
+	})
+	is.Nil(err)
+
+	f := new(blockingFlusher)
+	relay := outbox.NewRelay(ob, f,
+		outbox.WithPollInterval(10*time.Millisecond),
+		outbox.WithProcessTimeout(50*time.Millisecond),
+		outbox.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+
+	// The flush is cancelled after the timeout, and the transaction fails
+	// to record the attempt. The relay logs the error and retries, instead of
+	// returning.
+	stop := runRelay(t, relay)
+	is.Eventually(func() bool {
+		return f.calls.Load() >= 2
+	}, time.Second, 10*time.Millisecond)
+	stop()
+
+	count, err := ob.Count(ctx)
+	is.Nil(err)
+	is.Equal(int64(1), count)
+}
+
+type blockingFlusher struct {
+	calls atomic.Int64
+}
+
+func (f *blockingFlusher) Flush(ctx context.Context, events []outbox.Event) error {
+	f.calls.Add(1)
+	<-ctx.Done()
+
+	return ctx.Err()
+}
+
+func TestRelayDeadLetter(t *testing.T) {
+	is := assert.New(t)
+	ob := outbox.New(newDB(t))
+	ctx := context.Background()
+
+	err := ob.RunInTx(ctx, func(txCtx context.Context) error {
+		is.True(outbox.Enqueue(txCtx, outbox.Message{
+			AggregateID:   "a-id-1",
+			AggregateType: "a-type-1",
+			Type:          "type-1",
+			Payload:       json.RawMessage(`{}`),
+		}))
+
+		return nil
+	})
+	is.Nil(err)
+
+	var dead []outbox.Event
+	f := &failingFlusher{failures: math.MaxInt}
+	relay := outbox.NewRelay(ob, f,
+		outbox.WithPollInterval(10*time.Millisecond),
+		outbox.WithBackoff(func(attempt int) time.Duration {
+			return 0
+		}),
+		outbox.WithMaxAttempts(3),
+		outbox.WithDeadLetterHook(func(evt outbox.Event) {
+			dead = append(dead, evt)
+		}),
+	)
+
+	stop := runRelay(t, relay)
+	is.Eventually(isEmpty(ob), time.Second, 10*time.Millisecond)
+	stop()
+
+	is.Equal([]int{0, 1, 2}, f.attempts)
+	is.Len(dead, 1)
+	is.Equal(3, dead[0].Attempts)
+	is.Equal("broker unavailable", dead[0].LastError)
+
+	events, err := ob.LoadDeadLetters(ctx)
+	is.Nil(err)
+	is.Len(events, 1)
+	is.Equal(3, events[0].Attempts)
+	is.Equal("broker unavailable", events[0].LastError)
+
+	is.Nil(ob.Requeue(ctx, events[0].ID))
+
+	count, err := ob.Count(ctx)
+	is.Nil(err)
+	is.Equal(int64(1), count)
+
+	events, err = ob.LoadDeadLetters(ctx)
+	is.Nil(err)
+	is.Empty(events)
+}
+
+func TestRelayRetention(t *testing.T) {
+	is := assert.New(t)
+	db := newDB(t)
+	ob := outbox.New(db)
+	ctx := context.Background()
+
+	err := ob.RunInTx(ctx, func(txCtx context.Context) error {
+		is.True(outbox.Enqueue(txCtx, outbox.Message{
+			AggregateID:   "a-id-1",
+			AggregateType: "a-type-1",
+			Type:          "type-1",
+			Payload:       json.RawMessage(`{}`),
+		}))
+
+		return nil
+	})
+	is.Nil(err)
+
+	f := &mockFlusher{}
+	relay := outbox.NewRelay(ob, f,
+		outbox.WithPollInterval(10*time.Millisecond),
+		outbox.WithRetention(),
+	)
+
+	stop := runRelay(t, relay)
+	is.Eventually(isEmpty(ob), time.Second, 10*time.Millisecond)
+	stop()
+
+	is.Len(f.events, 1)
+
+	var processed int64
+	err = db.QueryRow(`SELECT COUNT(*) FROM outbox WHERE status = 'processed' AND processed_at IS NOT NULL`).Scan(&processed)
+	is.Nil(err)
+	is.Equal(int64(1), processed)
+
+	n, err := ob.Prune(ctx, time.Hour)
+	is.Nil(err)
+	is.Equal(int64(0), n)
+
+	n, err = ob.Prune(ctx, 0)
+	is.Nil(err)
+	is.Equal(int64(1), n)
+}
+
+func TestRelayOrderedByAggregate(t *testing.T) {
+	is := assert.New(t)
+	ob := outbox.New(newDB(t))
+	ctx := context.Background()
+
+	err := ob.RunInTx(ctx, func(txCtx context.Context) error {
+		for i := range 10 {
+			for _, id := range []string{"a", "b", "c"} {
+				is.True(outbox.Enqueue(txCtx, outbox.Message{
+					AggregateID:   id,
+					AggregateType: "ordered",
+					Type:          "type",
+					Payload:       json.RawMessage(fmt.Sprintf(`{"seq": %d}`, i)),
+				}))
+			}
+		}
+
+		return nil
+	})
+	is.Nil(err)
+
+	f := &orderedFlusher{seen: make(map[string][]int64)}
+
+	stops := make([]func(), 4)
+	for i := range stops {
+		stops[i] = runRelay(t, outbox.NewRelay(ob, f,
+			outbox.WithPollInterval(10*time.Millisecond),
+			outbox.WithOrderedByAggregate(),
+		))
+	}
+	is.Eventually(isEmpty(ob), 5*time.Second, 10*time.Millisecond)
+	for _, stop := range stops {
+		stop()
+	}
+
+	is.Len(f.seen, 3)
+	for id, ids := range f.seen {
+		is.Len(ids, 10, id)
+		is.True(slices.IsSorted(ids), id)
+	}
+}
+
+type orderedFlusher struct {
+	mu   sync.Mutex
+	seen map[string][]int64
+}
+
+func (f *orderedFlusher) Flush(ctx context.Context, events []outbox.Event) error {
+	// Simulates the latency of the broker, so that the relays overlap.
+	time.Sleep(time.Duration(rand.IntN(5)) * time.Millisecond)
+
+	f.mu.Lock()
+	for _, evt := range events {
+		f.seen[evt.AggregateID] = append(f.seen[evt.AggregateID], evt.ID)
+	}
+	f.mu.Unlock()
+
+	return nil
+}
+
+func TestRelayListener(t *testing.T) {
+	is := assert.New(t)
+	ob := outbox.New(newDB(t))
+	ctx := context.Background()
+
+	l := pq.NewListener(pgtest.DSN(), time.Second, time.Minute, nil)
+	t.Cleanup(func() {
+		l.Close()
+	})
+
+	f := &notifyFlusher{ch: make(chan outbox.Event, 1)}
+	relay := outbox.NewRelay(ob, f,
+		// The event should be published before the next poll.
+		outbox.WithPollInterval(time.Hour),
+		outbox.WithListener(l),
+	)
+
+	runRelay(t, relay)
+
+	// The relay polls the outbox only once on start, so the subsequent events
+	// are published only when notified.
+	for _, typ := range []string{"notify-1", "notify-2"} {
+		err := ob.RunInTx(ctx, func(txCtx context.Context) error {
+			is.True(outbox.Enqueue(txCtx, outbox.Message{
+				AggregateID:   "a-id-1",
+				AggregateType: "a-type-1",
+				Type:          typ,
+				Payload:       json.RawMessage(`{}`),
+			}))
+
+			return nil
+		})
+		is.Nil(err)
+
+		select {
+		case evt := <-f.ch:
+			is.Equal(typ, evt.Type)
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for event %q", typ)
+		}
+	}
+}
+
+type notifyFlusher struct {
+	ch chan outbox.Event
+}
+
+func (f *notifyFlusher) Flush(ctx context.Context, events []outbox.Event) error {
+	for _, evt := range events {
+		f.ch <- evt
+	}
+
+	return nil
+}
+
+func TestMetadata(t *testing.T) {
+	is := assert.New(t)
+	ob := outbox.New(newDB(t)).WithMetadata(func(ctx context.Context) map[string]string {
+		return map[string]string{
+			"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			"tenant":      "default",
+		}
+	})
+	ctx := context.Background()
+
+	err := ob.RunInTx(ctx, func(txCtx context.Context) error {
+		is.True(outbox.Enqueue(txCtx, outbox.Message{
+			AggregateID:   "a-id-1",
+			AggregateType: "a-type-1",
+			Type:          "type-1",
+			Payload:       json.RawMessage(`{}`),
+			Metadata: map[string]string{
+				"tenant": "custom",
+			},
+		}))
+
+		return nil
+	})
+	is.Nil(err)
+
+	err = ob.Process(ctx, func(txCtx context.Context, evt outbox.Event) error {
+		is.Equal(map[string]string{
+			"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			"tenant":      "custom",
+		}, evt.Metadata)
+
+		return nil
+	})
+	is.Nil(err)
+}
+
+func TestPropagator(t *testing.T) {
+	is := assert.New(t)
+	p := requestIDPropagator{}
+	ob := outbox.New(newDB(t)).WithPropagator(p)
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-1")
+
+	err := ob.RunInTx(ctx, func(txCtx context.Context) error {
+		is.True(outbox.Enqueue(txCtx, outbox.Message{
+			AggregateID:   "a-id-1",
+			AggregateType: "a-type-1",
+			Type:          "type-1",
+			Payload:       json.RawMessage(`{}`),
+		}))
+
+		return nil
+	})
+	is.Nil(err)
+
+	err = ob.Process(context.Background(), func(txCtx context.Context, evt outbox.Event) error {
+		is.Equal(map[string]string{"request_id": "req-1"}, evt.Metadata)
+		is.Equal("req-1", outbox.Extract(txCtx, p, evt).Value(requestIDKey{}))
+
+		return nil
+	})
+	is.Nil(err)
+}
+
+type requestIDKey struct{}
+
+// requestIDPropagator propagates the request id, in place of the trace
+// context.
+type requestIDPropagator struct{}
+
+func (requestIDPropagator) Inject(ctx context.Context) map[string]string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return map[string]string{"request_id": id}
+}
+
+func (requestIDPropagator) Extract(ctx context.Context, metadata map[string]string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, metadata["request_id"])
+}
+
+func TestUpgrade(t *testing.T) {
+	ctx := context.Background()
+	tx, err := pgtest.DB(t).BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	// Creates the table from the earlier schema in a separate schema, so that
+	// it does not conflict with the migrated table.
+	_, err = tx.ExecContext(ctx, `
+		CREATE SCHEMA legacy;
+		SET LOCAL search_path TO legacy;
+
+		CREATE TABLE outbox (
+			id bigint GENERATED ALWAYS AS IDENTITY,
+			aggregate_id text NOT NULL,
+			aggregate_type text NOT NULL,
+			type text NOT NULL,
+			payload jsonb NOT NULL DEFAULT '{}',
+			created_at timestamptz NOT NULL DEFAULT now(),
+			PRIMARY KEY (id)
+		);
+
+		INSERT INTO outbox (aggregate_id, aggregate_type, type)
+		VALUES ('a-id', 'a-type', 'type');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	is := assert.New(t)
+	is.Nil(outbox.Upgrade(ctx, tx))
+	is.Nil(outbox.Upgrade(ctx, tx), "idempotent")
+
+	var attempts int
+	var status, metadata string
+	err = tx.QueryRowContext(ctx, `
+		SELECT attempts, status, metadata
+		FROM outbox
+		WHERE next_attempt_at <= now()
+	`).Scan(&attempts, &status, &metadata)
+	is.Nil(err)
+	is.Equal(0, attempts)
+	is.Equal("pending", status)
+	is.JSONEq(`{}`, metadata)
+}
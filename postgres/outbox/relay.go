@@ -0,0 +1,300 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/alextanhongpin/dbtx"
+	"github.com/alextanhongpin/dbtx/postgres/outbox/internal/postgres"
+	"github.com/lib/pq"
+)
+
+// flusher publishes the outbox events, e.g. to a message broker.
+type flusher interface {
+	Flush(ctx context.Context, events []Event) error
+}
+
+// Relay continuously processes the outbox events and publishes them with the
+// flusher.
+// The events are claimed with FOR UPDATE SKIP LOCKED, so multiple relays can
+// run concurrently.
+type Relay struct {
+	outbox       *Outbox
+	flusher      flusher
+	pollInterval time.Duration
+	backoff      func(attempt int) time.Duration
+	maxAttempts  int
+	onDeadLetter func(Event)
+	retention    bool
+	ordered      bool
+	listener     *pq.Listener
+	timeout      time.Duration
+	logger       *slog.Logger
+}
+
+// RelayOption configures the Relay.
+type RelayOption func(*Relay)
+
+// WithPollInterval sets the duration to wait before polling again when the
+// outbox is empty.
+func WithPollInterval(d time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.pollInterval = d
+	}
+}
+
+// WithBackoff sets the duration to wait before retrying an event that failed
+// to be published. The attempt starts from 1.
+// Defaults to exponential backoff starting from 1s, up to 1h.
+func WithBackoff(fn func(attempt int) time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.backoff = fn
+	}
+}
+
+// WithMaxAttempts sets the number of attempts before the event is
+// dead-lettered. Dead-lettered events are not retried until they are requeued.
+// Defaults to 0, which retries forever.
+func WithMaxAttempts(n int) RelayOption {
+	return func(r *Relay) {
+		r.maxAttempts = n
+	}
+}
+
+// WithDeadLetterHook sets the fn to be called when an event is dead-lettered,
+// e.g. to send an alert. The fn is called after the transaction is committed.
+func WithDeadLetterHook(fn func(Event)) RelayOption {
+	return func(r *Relay) {
+		r.onDeadLetter = fn
+	}
+}
+
+// WithRetention marks the published events as processed instead of deleting
+// them, to keep an audit trail. Use Outbox.Prune to delete the old processed
+// events.
+func WithRetention() RelayOption {
+	return func(r *Relay) {
+		r.retention = true
+	}
+}
+
+// WithOrderedByAggregate processes the events of the same aggregate in order,
+// even with multiple relays running concurrently. Only the oldest event of
+// each aggregate is claimed, and the aggregate is locked until the
+// transaction ends.
+// This reduces the throughput, since the events of the same aggregate are no
+// longer processed concurrently, and a failing event blocks the subsequent
+// events of the same aggregate until it succeeds or is dead-lettered.
+func WithOrderedByAggregate() RelayOption {
+	return func(r *Relay) {
+		r.ordered = true
+	}
+}
+
+// WithListener wakes up the relay immediately when new events are inserted,
+// instead of waiting for the poll interval. The poll interval is still used as
+// a fallback, in case the notification is missed.
+// The listener holds a dedicated connection for LISTEN, separate from the
+// connection pool, and requires the trigger from InstallTrigger.
+func WithListener(l *pq.Listener) RelayOption {
+	return func(r *Relay) {
+		r.listener = l
+	}
+}
+
+// WithProcessTimeout sets the maximum duration to claim, publish and commit
+// an event. Since an event that is already claimed is processed even if the
+// Run context is cancelled, this bounds how long the shutdown can take.
+// Defaults to 30s.
+func WithProcessTimeout(d time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.timeout = d
+	}
+}
+
+// WithLogger sets the logger for the errors that are retried by the relay.
+// Defaults to slog.Default().
+func WithLogger(l *slog.Logger) RelayOption {
+	return func(r *Relay) {
+		r.logger = l
+	}
+}
+
+func NewRelay(o *Outbox, f flusher, opts ...RelayOption) *Relay {
+	r := &Relay{
+		outbox:       o,
+		flusher:      f,
+		pollInterval: time.Second,
+		backoff:      exponentialBackoff,
+		timeout:      30 * time.Second,
+		logger:       slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Run processes the outbox events until the context is cancelled.
+// An event that is already claimed is published and committed even if the
+// context is cancelled, so that it is not published twice, up to the
+// WithProcessTimeout.
+// When the event fails to be published, the error is recorded and the event
+// is rescheduled with backoff instead of being deleted.
+// Other errors, such as a lost database connection, are logged and retried
+// with backoff, and a listener that fails to listen falls back to polling.
+// Returns nil when the context is cancelled.
+func (r *Relay) Run(ctx context.Context) error {
+	notify := r.listen(ctx)
+
+	var failures int
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		err := r.process(ctx)
+		if errors.Is(err, Empty) {
+			failures = 0
+			if r.listener != nil && notify == nil {
+				notify = r.listen(ctx)
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(r.pollInterval):
+			case <-notify:
+				// A nil notification is sent after reconnecting, which may have
+				// missed notifications, so it also wakes up the relay.
+			}
+
+			continue
+		}
+		if err != nil {
+			failures++
+			r.logger.ErrorContext(ctx, "outbox: failed to process event",
+				slog.Int("failures", failures),
+				slog.Any("err", err),
+			)
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(r.retryAfter(failures)):
+			}
+
+			continue
+		}
+
+		failures = 0
+	}
+}
+
+// listen returns the channel that is notified when new events are inserted,
+// or nil when there is no listener or it fails to listen.
+func (r *Relay) listen(ctx context.Context) <-chan *pq.Notification {
+	if r.listener == nil {
+		return nil
+	}
+
+	// The listener may be shared by multiple relays.
+	err := r.listener.Listen(Channel)
+	if err != nil && !errors.Is(err, pq.ErrChannelAlreadyOpen) {
+		r.logger.WarnContext(ctx, "outbox: failed to listen, falling back to polling",
+			slog.Any("err", err),
+		)
+
+		return nil
+	}
+
+	return r.listener.Notify
+}
+
+// retryAfter returns the duration to wait after consecutive failures,
+// doubling from the poll interval up to a minute.
+func (r *Relay) retryAfter(failures int) time.Duration {
+	d := r.pollInterval
+	for range failures - 1 {
+		if d >= time.Minute {
+			break
+		}
+
+		d *= 2
+	}
+
+	return min(d, time.Minute)
+}
+
+func (r *Relay) process(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.timeout)
+	defer cancel()
+
+	return r.outbox.Atomic.RunInTx(ctx, func(txCtx context.Context) error {
+		q := r.outbox.db(txCtx)
+		claim := q.Claim
+		if r.ordered {
+			claim = q.ClaimOrdered
+		}
+
+		e, err := claim(txCtx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return Empty
+		}
+		if err != nil {
+			return err
+		}
+
+		evt, err := newEvent(e)
+		if err != nil {
+			return err
+		}
+
+		if err := r.flusher.Flush(txCtx, []Event{evt}); err != nil {
+			return r.fail(txCtx, q, evt, err)
+		}
+
+		if r.retention {
+			return q.MarkProcessed(txCtx, e.ID)
+		}
+
+		return q.DeleteByID(txCtx, e.ID)
+	})
+}
+
+func (r *Relay) fail(ctx context.Context, q postgres.Querier, evt Event, err error) error {
+	evt.Attempts++
+	evt.LastError = err.Error()
+
+	if r.maxAttempts > 0 && evt.Attempts >= r.maxAttempts {
+		if r.onDeadLetter != nil {
+			dbtx.OnCommit(ctx, func() {
+				r.onDeadLetter(evt)
+			})
+		}
+
+		return q.DeadLetter(ctx, postgres.DeadLetterParams{
+			ID:        evt.ID,
+			LastError: evt.LastError,
+		})
+	}
+
+	return q.Fail(ctx, postgres.FailParams{
+		ID:        evt.ID,
+		LastError: evt.LastError,
+		Backoff:   r.backoff(evt.Attempts).Seconds(),
+	})
+}
+
+func exponentialBackoff(attempt int) time.Duration {
+	// Prevents overflow, 1s << 12 is already more than 1h.
+	if attempt > 12 {
+		return time.Hour
+	}
+
+	return min(time.Second<<max(attempt-1, 0), time.Hour)
+}
@@ -0,0 +1,105 @@
+package violations
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The sentinel errors for the codes, to be compared with ViolationError using
+// errors.Is.
+var (
+	ErrIntegrityConstraint  = errors.New("violations: integrity constraint")
+	ErrRestrict             = errors.New("violations: restrict")
+	ErrNotNull              = errors.New("violations: not null")
+	ErrForeignKey           = errors.New("violations: foreign key")
+	ErrUnique               = errors.New("violations: unique")
+	ErrCheck                = errors.New("violations: check")
+	ErrExclusion            = errors.New("violations: exclusion")
+	ErrTriggerException     = errors.New("violations: trigger exception")
+	ErrSerializationFailure = errors.New("violations: serialization failure")
+	ErrDeadlock             = errors.New("violations: deadlock")
+	ErrLockNotAvailable     = errors.New("violations: lock not available")
+)
+
+var sentinels = map[string]error{
+	IntegrityConstraint:  ErrIntegrityConstraint,
+	Restrict:             ErrRestrict,
+	NotNull:              ErrNotNull,
+	ForeignKey:           ErrForeignKey,
+	Unique:               ErrUnique,
+	Check:                ErrCheck,
+	Exclusion:            ErrExclusion,
+	TriggerException:     ErrTriggerException,
+	SerializationFailure: ErrSerializationFailure,
+	Deadlock:             ErrDeadlock,
+	LockNotAvailable:     ErrLockNotAvailable,
+}
+
+// ViolationError wraps the postgres error, regardless of the driver.
+type ViolationError struct {
+	err        error
+	code       string
+	constraint string
+	column     string
+}
+
+// NewViolationError returns the ViolationError if err is a postgres error.
+func NewViolationError(err error) (*ViolationError, bool) {
+	code, ok := Code(err)
+	if !ok {
+		return nil, false
+	}
+
+	constraint, _ := ConstraintName(err)
+	column, _ := ColumnName(err)
+
+	return &ViolationError{
+		err:        err,
+		code:       code,
+		constraint: constraint,
+		column:     column,
+	}, true
+}
+
+func (e *ViolationError) Code() string {
+	return e.code
+}
+
+func (e *ViolationError) Constraint() string {
+	return e.constraint
+}
+
+func (e *ViolationError) Column() string {
+	return e.column
+}
+
+func (e *ViolationError) Error() string {
+	return fmt.Sprintf("violations: %s: %s", e.code, e.err)
+}
+
+func (e *ViolationError) Unwrap() error {
+	return e.err
+}
+
+// Is returns true if the target is the sentinel error of the code, e.g.
+// ErrUnique.
+func (e *ViolationError) Is(target error) bool {
+	sentinel, ok := sentinels[e.code]
+	return ok && sentinel == target
+}
+
+// Map returns the error mapped to the name of the violated constraint, e.g.
+// {"users_email_key": ErrEmailTaken}.
+// Returns the original error if there are no matching constraint.
+func Map(err error, m map[string]error) error {
+	constraint, ok := ConstraintName(err)
+	if !ok {
+		return err
+	}
+
+	if mapped, ok := m[constraint]; ok {
+		return mapped
+	}
+
+	return err
+}
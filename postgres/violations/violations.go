@@ -11,6 +11,12 @@
 	23505	unique_violation
 	23514	check_violation
 	23P01	exclusion_violation
+
+	And the transient errors that can be retried
+
+	40001	serialization_failure
+	40P01	deadlock_detected
+	55P03	lock_not_available
 */
 
 package violations
@@ -18,6 +24,7 @@ package violations
 import (
 	"errors"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/lib/pq"
 )
 
@@ -30,6 +37,10 @@ const (
 	Check               = "23514"
 	Exclusion           = "23P01"
 	TriggerException    = "P0000"
+
+	SerializationFailure = "40001"
+	Deadlock             = "40P01"
+	LockNotAvailable     = "55P03"
 )
 
 func As(err error) (*pq.Error, bool) {
@@ -41,9 +52,81 @@ func As(err error) (*pq.Error, bool) {
 	return nil, false
 }
 
+// sqlState is implemented by the errors of the postgres drivers, such as
+// *pq.Error and pgx's *pgconn.PgError.
+type sqlState interface {
+	SQLState() string
+}
+
+// Code returns the SQLSTATE code of the postgres error, regardless of the
+// driver.
+func Code(err error) (string, bool) {
+	var se sqlState
+	if errors.As(err, &se) {
+		return se.SQLState(), true
+	}
+
+	return "", false
+}
+
 func IsCode(err error, code string) bool {
-	pqErr, ok := As(err)
-	return ok && pqErr.Code == pq.ErrorCode(code)
+	c, ok := Code(err)
+	return ok && c == code
+}
+
+// ConstraintName returns the name of the constraint that is violated, e.g.
+// users_email_key.
+func ConstraintName(err error) (string, bool) {
+	return field(err, func(e *pq.Error) string {
+		return e.Constraint
+	}, func(e *pgconn.PgError) string {
+		return e.ConstraintName
+	})
+}
+
+// ColumnName returns the name of the column of the error.
+func ColumnName(err error) (string, bool) {
+	return field(err, func(e *pq.Error) string {
+		return e.Column
+	}, func(e *pgconn.PgError) string {
+		return e.ColumnName
+	})
+}
+
+// TableName returns the name of the table of the error.
+func TableName(err error) (string, bool) {
+	return field(err, func(e *pq.Error) string {
+		return e.Table
+	}, func(e *pgconn.PgError) string {
+		return e.TableName
+	})
+}
+
+// Detail returns the detail of the error, e.g.
+// Key (email)=(john.appleseed@mail.com) already exists.
+func Detail(err error) (string, bool) {
+	return field(err, func(e *pq.Error) string {
+		return e.Detail
+	}, func(e *pgconn.PgError) string {
+		return e.Detail
+	})
+}
+
+// field returns the field of the *pq.Error or pgx's *pgconn.PgError. Returns
+// false if the field is empty.
+func field(err error, pqFn func(*pq.Error) string, pgFn func(*pgconn.PgError) string) (string, bool) {
+	var pqErr *pq.Error
+	var pgErr *pgconn.PgError
+
+	var s string
+	switch {
+	case errors.As(err, &pqErr):
+		s = pqFn(pqErr)
+	case errors.As(err, &pgErr):
+		s = pgFn(pgErr)
+	}
+
+	return s, s != ""
 }
 
 func IsIntegrityConstraint(err error) bool {
@@ -80,3 +163,25 @@ func IsExclusion(err error) bool {
 func IsTriggerException(err error) bool {
 	return IsCode(err, TriggerException)
 }
+
+// IsSerializationFailure can be used to test if the serializable transaction
+// failed due to concurrent updates, and should be retried.
+func IsSerializationFailure(err error) bool {
+	return IsCode(err, SerializationFailure)
+}
+
+func IsDeadlock(err error) bool {
+	return IsCode(err, Deadlock)
+}
+
+// IsLockNotAvailable can be used to test if the lock_timeout is exceeded, or
+// the lock cannot be acquired with NOWAIT.
+func IsLockNotAvailable(err error) bool {
+	return IsCode(err, LockNotAvailable)
+}
+
+// IsRetryable returns true if the error is transient, and the transaction can
+// be retried.
+func IsRetryable(err error) bool {
+	return IsSerializationFailure(err) || IsDeadlock(err) || IsLockNotAvailable(err)
+}
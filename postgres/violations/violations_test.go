@@ -0,0 +1,192 @@
+package violations_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/alextanhongpin/core/storage/pg/pgtest"
+	"github.com/alextanhongpin/dbtx/postgres/violations"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+const postgresVersion = "postgres:15.1-alpine"
+
+func TestMain(m *testing.M) {
+	stop := pgtest.Init(pgtest.Image(postgresVersion))
+	defer stop()
+
+	m.Run()
+}
+
+func TestIsCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"pq", &pq.Error{Code: violations.Unique}},
+		{"pgx", &pgconn.PgError{Code: violations.Unique}},
+		{"wrapped", fmt.Errorf("insert: %w", &pgconn.PgError{Code: violations.Unique})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := assert.New(t)
+			is.True(violations.IsUnique(tt.err))
+			is.False(violations.IsForeignKey(tt.err))
+
+			code, ok := violations.Code(tt.err)
+			is.True(ok)
+			is.Equal(violations.Unique, code)
+		})
+	}
+
+	t.Run("not postgres", func(t *testing.T) {
+		is := assert.New(t)
+		is.False(violations.IsUnique(fmt.Errorf("unique")))
+
+		_, ok := violations.Code(fmt.Errorf("unique"))
+		is.False(ok)
+	})
+}
+
+func TestFields(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"pq", &pq.Error{
+			Code:       violations.Unique,
+			Detail:     "Key (email)=(john@mail.com) already exists.",
+			Table:      "users",
+			Column:     "email",
+			Constraint: "users_email_key",
+		}},
+		{"pgx", &pgconn.PgError{
+			Code:           violations.Unique,
+			Detail:         "Key (email)=(john@mail.com) already exists.",
+			TableName:      "users",
+			ColumnName:     "email",
+			ConstraintName: "users_email_key",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := assert.New(t)
+			err := fmt.Errorf("create user: %w", tt.err)
+
+			constraint, ok := violations.ConstraintName(err)
+			is.True(ok)
+			is.Equal("users_email_key", constraint)
+
+			column, ok := violations.ColumnName(err)
+			is.True(ok)
+			is.Equal("email", column)
+
+			table, ok := violations.TableName(err)
+			is.True(ok)
+			is.Equal("users", table)
+
+			detail, ok := violations.Detail(err)
+			is.True(ok)
+			is.Equal("Key (email)=(john@mail.com) already exists.", detail)
+		})
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		is := assert.New(t)
+
+		_, ok := violations.ConstraintName(&pq.Error{Code: violations.NotNull})
+		is.False(ok)
+
+		_, ok = violations.ConstraintName(fmt.Errorf("users_email_key"))
+		is.False(ok)
+	})
+}
+
+func TestIsRetryable(t *testing.T) {
+	is := assert.New(t)
+	is.True(violations.IsRetryable(&pq.Error{Code: violations.SerializationFailure}))
+	is.True(violations.IsRetryable(&pq.Error{Code: violations.Deadlock}))
+	is.True(violations.IsRetryable(&pgconn.PgError{Code: violations.LockNotAvailable}))
+	is.False(violations.IsRetryable(&pq.Error{Code: violations.Unique}))
+	is.False(violations.IsRetryable(fmt.Errorf("deadlock")))
+}
+
+func TestMap(t *testing.T) {
+	ErrEmailTaken := errors.New("email already taken")
+
+	m := map[string]error{
+		"users_email_key": ErrEmailTaken,
+	}
+
+	t.Run("mapped", func(t *testing.T) {
+		err := &pq.Error{Code: violations.Unique, Constraint: "users_email_key"}
+		assert.ErrorIs(t, violations.Map(err, m), ErrEmailTaken)
+	})
+
+	t.Run("not mapped", func(t *testing.T) {
+		err := &pq.Error{Code: violations.Unique, Constraint: "users_name_key"}
+		assert.Equal(t, err, violations.Map(err, m))
+	})
+
+	t.Run("not postgres", func(t *testing.T) {
+		err := errors.New("users_email_key")
+		assert.Equal(t, err, violations.Map(err, m))
+	})
+}
+
+func TestViolationError(t *testing.T) {
+	is := assert.New(t)
+
+	pqErr := &pq.Error{Code: violations.Unique, Constraint: "users_email_key", Column: "email"}
+	err, ok := violations.NewViolationError(fmt.Errorf("create user: %w", pqErr))
+	is.True(ok)
+	is.Equal(violations.Unique, err.Code())
+	is.Equal("users_email_key", err.Constraint())
+	is.Equal("email", err.Column())
+	is.ErrorIs(err, violations.ErrUnique)
+	is.NotErrorIs(err, violations.ErrForeignKey)
+	is.ErrorIs(err, pqErr)
+
+	_, ok = violations.NewViolationError(errors.New("bad"))
+	is.False(ok)
+}
+
+func TestPgxUniqueViolation(t *testing.T) {
+	is := assert.New(t)
+
+	db, err := sql.Open("pgx", pgtest.DSN())
+	is.NoError(err)
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	// The temporary table is only visible to the connection, so run the
+	// statements in a single transaction.
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	is.NoError(err)
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `CREATE TEMPORARY TABLE users (email text CONSTRAINT users_email_key UNIQUE)`)
+	is.NoError(err)
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO users (email) VALUES ($1)`, "john.appleseed@mail.com")
+	is.NoError(err)
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO users (email) VALUES ($1)`, "john.appleseed@mail.com")
+	var pgErr *pgconn.PgError
+	is.ErrorAs(err, &pgErr)
+
+	verr, ok := violations.NewViolationError(err)
+	is.True(ok)
+	is.ErrorIs(verr, violations.ErrUnique)
+	is.Equal("users_email_key", verr.Constraint())
+}
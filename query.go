@@ -0,0 +1,24 @@
+package dbtx
+
+import (
+	"context"
+)
+
+// Get scans the single column of the first row into T.
+// Returns the zero value and sql.ErrNoRows if there are no rows.
+func Get[T any](ctx context.Context, db DBTX, query string, args ...any) (T, error) {
+	var v T
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&v); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return v, nil
+}
+
+// Exists returns true if the query returns at least one row.
+// The query is wrapped with SELECT EXISTS(...), so it must be a SELECT
+// statement without the trailing semicolon.
+func Exists(ctx context.Context, db DBTX, query string, args ...any) (bool, error) {
+	return Get[bool](ctx, db, `SELECT EXISTS(`+query+`)`, args...)
+}
@@ -0,0 +1,112 @@
+package dbtx
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// WithHook returns a middleware that calls before and after around each
+// method, e.g. to count the queries or enforce policies, without implementing
+// the whole DBTX interface.
+// The context returned by before is passed to the method and after, which
+// allows before to attach values that after reads. The non-context methods
+// are called with context.Background().
+// For QueryRow, the error is the error of the *sql.Row, which is only
+// available before Scan if the query fails to execute.
+// Either before or after can be nil.
+func WithHook(
+	before func(ctx context.Context, method, query string, args []any) context.Context,
+	after func(ctx context.Context, method, query string, err error, dur time.Duration),
+) func(DBTX) DBTX {
+	return func(dbtx DBTX) DBTX {
+		return &hook{dbtx: dbtx, before: before, after: after}
+	}
+}
+
+var _ DBTX = (*hook)(nil)
+
+type hook struct {
+	dbtx   DBTX
+	before func(ctx context.Context, method, query string, args []any) context.Context
+	after  func(ctx context.Context, method, query string, err error, dur time.Duration)
+}
+
+func (h *hook) Exec(query string, args ...any) (sql.Result, error) {
+	ctx, done := h.start(context.Background(), "Exec", query, args)
+	res, err := h.dbtx.Exec(query, args...)
+	done(ctx, err)
+
+	return res, err
+}
+
+func (h *hook) Prepare(query string) (*sql.Stmt, error) {
+	ctx, done := h.start(context.Background(), "Prepare", query, nil)
+	stmt, err := h.dbtx.Prepare(query)
+	done(ctx, err)
+
+	return stmt, err
+}
+
+func (h *hook) Query(query string, args ...any) (*sql.Rows, error) {
+	ctx, done := h.start(context.Background(), "Query", query, args)
+	rows, err := h.dbtx.Query(query, args...)
+	done(ctx, err)
+
+	return rows, err
+}
+
+func (h *hook) QueryRow(query string, args ...any) *sql.Row {
+	ctx, done := h.start(context.Background(), "QueryRow", query, args)
+	row := h.dbtx.QueryRow(query, args...)
+	done(ctx, row.Err())
+
+	return row
+}
+
+func (h *hook) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, done := h.start(ctx, "ExecContext", query, args)
+	res, err := h.dbtx.ExecContext(ctx, query, args...)
+	done(ctx, err)
+
+	return res, err
+}
+
+func (h *hook) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, done := h.start(ctx, "PrepareContext", query, nil)
+	stmt, err := h.dbtx.PrepareContext(ctx, query)
+	done(ctx, err)
+
+	return stmt, err
+}
+
+func (h *hook) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, done := h.start(ctx, "QueryContext", query, args)
+	rows, err := h.dbtx.QueryContext(ctx, query, args...)
+	done(ctx, err)
+
+	return rows, err
+}
+
+func (h *hook) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, done := h.start(ctx, "QueryRowContext", query, args)
+	row := h.dbtx.QueryRowContext(ctx, query, args...)
+	done(ctx, row.Err())
+
+	return row
+}
+
+// start calls the before hook, and returns the fn that calls the after hook.
+func (h *hook) start(ctx context.Context, method, query string, args []any) (context.Context, func(context.Context, error)) {
+	if h.before != nil {
+		ctx = h.before(ctx, method, query, args)
+	}
+
+	start := time.Now()
+
+	return ctx, func(ctx context.Context, err error) {
+		if h.after != nil {
+			h.after(ctx, method, query, err, time.Since(start))
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package dbtx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var ErrTooManyRowsAffected = errors.New("dbtx: too many rows affected")
+
+// WithMaxRowsAffected returns ErrTooManyRowsAffected when the number of rows
+// affected by Exec exceeds n, e.g. an UPDATE or DELETE without WHERE.
+// The statement is already executed when the error is returned, so outside a
+// transaction, this only detects the issue.
+// Within a transaction context, the transaction is also rolled back on commit,
+// even if the error is ignored by the caller.
+func WithMaxRowsAffected(n int64) func(DBTX) DBTX {
+	return func(dbtx DBTX) DBTX {
+		return &maxRowsAffected{dbtx: dbtx, n: n}
+	}
+}
+
+var _ DBTX = (*maxRowsAffected)(nil)
+
+type maxRowsAffected struct {
+	dbtx DBTX
+	n    int64
+}
+
+func (m *maxRowsAffected) Exec(query string, args ...any) (sql.Result, error) {
+	res, err := m.dbtx.Exec(query, args...)
+	if err != nil {
+		return res, err
+	}
+
+	return res, m.check(res)
+}
+
+func (m *maxRowsAffected) Prepare(query string) (*sql.Stmt, error) {
+	return m.dbtx.Prepare(query)
+}
+
+func (m *maxRowsAffected) Query(query string, args ...any) (*sql.Rows, error) {
+	return m.dbtx.Query(query, args...)
+}
+
+func (m *maxRowsAffected) QueryRow(query string, args ...any) *sql.Row {
+	return m.dbtx.QueryRow(query, args...)
+}
+
+func (m *maxRowsAffected) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	res, err := m.dbtx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return res, err
+	}
+
+	err = m.check(res)
+	if err != nil && IsTx(ctx) {
+		_ = OnBeforeCommit(ctx, func(context.Context) error {
+			return err
+		})
+	}
+
+	return res, err
+}
+
+func (m *maxRowsAffected) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return m.dbtx.PrepareContext(ctx, query)
+}
+
+func (m *maxRowsAffected) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return m.dbtx.QueryContext(ctx, query, args...)
+}
+
+func (m *maxRowsAffected) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return m.dbtx.QueryRowContext(ctx, query, args...)
+}
+
+func (m *maxRowsAffected) check(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		// The driver does not support RowsAffected.
+		return nil
+	}
+	if n > m.n {
+		return fmt.Errorf("%w: %d > %d", ErrTooManyRowsAffected, n, m.n)
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package dbtx
+
+import (
+	"context"
+	"log/slog"
+)
+
+var _ logger = (*SlogLogger)(nil)
+
+// SlogLogger logs the queries with *slog.Logger, to be used with WithLogger.
+type SlogLogger struct {
+	l        *slog.Logger
+	level    slog.Level
+	redactor func(query string, args []any) []any
+}
+
+// NewSlogLogger returns a SlogLogger that logs at the given level.
+// The args are redacted with RedactAll by default, so that sensitive data does
+// not end up in the logs.
+func NewSlogLogger(l *slog.Logger, level slog.Level) *SlogLogger {
+	return &SlogLogger{
+		l:        l,
+		level:    level,
+		redactor: RedactAll,
+	}
+}
+
+// WithRedactor returns a copy of the SlogLogger that redacts the args with
+// the given fn. Pass nil to log the args as it is.
+func (s *SlogLogger) WithRedactor(fn func(query string, args []any) []any) *SlogLogger {
+	return &SlogLogger{
+		l:        s.l,
+		level:    s.level,
+		redactor: fn,
+	}
+}
+
+func (s *SlogLogger) Log(ctx context.Context, method, query string, args ...any) {
+	if !s.l.Enabled(ctx, s.level) {
+		return
+	}
+
+	if s.redactor != nil {
+		args = s.redactor(query, args)
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("query", query),
+		slog.Any("args", args),
+	}
+	if raw, ok := RawQuery(ctx); ok {
+		attrs = append(attrs, slog.String("raw_query", raw))
+	}
+
+	s.l.LogAttrs(ctx, s.level, "dbtx: query", attrs...)
+}
@@ -0,0 +1,73 @@
+package dbtx_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/alextanhongpin/dbtx"
+	"github.com/alextanhongpin/dbtx/dbtxmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogLogger(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("redacted", func(t *testing.T) {
+		is := assert.New(t)
+
+		var buf bytes.Buffer
+		l := dbtx.NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil)), slog.LevelInfo)
+		l.Log(ctx, "ExecContext", "select $1", "secret")
+
+		var got map[string]any
+		is.Nil(json.Unmarshal(buf.Bytes(), &got))
+		is.Equal("INFO", got["level"])
+		is.Equal("ExecContext", got["method"])
+		is.Equal("select $1", got["query"])
+		is.Equal([]any{"?"}, got["args"])
+	})
+
+	t.Run("not redacted", func(t *testing.T) {
+		is := assert.New(t)
+
+		var buf bytes.Buffer
+		l := dbtx.NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil)), slog.LevelInfo).WithRedactor(nil)
+		l.Log(ctx, "ExecContext", "select $1", "secret")
+
+		var got map[string]any
+		is.Nil(json.Unmarshal(buf.Bytes(), &got))
+		is.Equal([]any{"secret"}, got["args"])
+	})
+
+	t.Run("normalized", func(t *testing.T) {
+		is := assert.New(t)
+
+		var buf bytes.Buffer
+		l := dbtx.NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil)), slog.LevelInfo)
+		db := &dbtxmock.DB{
+			ExecFunc: func(ctx context.Context, query string, args ...any) (sql.Result, error) {
+				return dbtxmock.Result{}, nil
+			},
+		}
+		_, err := dbtx.NewLogger(db, l, dbtx.WithNormalize()).ExecContext(ctx, "select  1, $1", "secret")
+		is.Nil(err)
+
+		var got map[string]any
+		is.Nil(json.Unmarshal(buf.Bytes(), &got))
+		is.Equal("select ?, $1", got["query"])
+		is.Equal("select  1, $1", got["raw_query"])
+	})
+
+	t.Run("disabled level", func(t *testing.T) {
+		is := assert.New(t)
+
+		var buf bytes.Buffer
+		l := dbtx.NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil)), slog.LevelDebug)
+		l.Log(ctx, "ExecContext", "select 1")
+		is.Empty(buf.String())
+	})
+}
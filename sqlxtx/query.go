@@ -0,0 +1,32 @@
+package sqlxtx
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// NamedExec executes the named query with the DBTX from the context, so that
+// it participates in the transaction if there is one.
+func NamedExec(ctx context.Context, a *Atomic, query string, arg any) (sql.Result, error) {
+	return sqlx.NamedExecContext(ctx, a.DBTx(ctx), query, arg)
+}
+
+// NamedQuery runs the named query with the DBTX from the context, so that it
+// participates in the transaction if there is one.
+func NamedQuery(ctx context.Context, a *Atomic, query string, arg any) (*sqlx.Rows, error) {
+	return sqlx.NamedQueryContext(ctx, a.DBTx(ctx), query, arg)
+}
+
+// Get scans a single row into dest with the DBTX from the context, so that it
+// sees the uncommitted writes in the transaction.
+func Get[T any](ctx context.Context, a *Atomic, dest *T, query string, args ...any) error {
+	return sqlx.GetContext(ctx, a.DBTx(ctx), dest, query, args...)
+}
+
+// Select scans all the rows into dest with the DBTX from the context, so that
+// it sees the uncommitted writes in the transaction.
+func Select[T any](ctx context.Context, a *Atomic, dest *[]T, query string, args ...any) error {
+	return sqlx.SelectContext(ctx, a.DBTx(ctx), dest, query, args...)
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 
+	"github.com/alextanhongpin/dbtx/unitofwork"
 	"github.com/jmoiron/sqlx"
 )
 
-var ErrNotTransaction = errors.New("sqltx: underlying type is not a transaction")
+// ErrNotTransaction is the same error as dbtx.ErrNotTransaction.
+var ErrNotTransaction = unitofwork.ErrNotTransaction
 
 // DBTX represents the common db operations for both *sql.DB and *sql.Tx.
 type DBTX = sqlx.ExtContext
@@ -64,11 +66,20 @@ func (a *Atomic) RunInTx(ctx context.Context, fn func(context.Context) error) (e
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
+	defer func() {
+		if r := recover(); r != nil {
+			err := tx.Rollback()
+			if e, ok := r.(error); ok {
+				panic(errors.Join(err, e))
+			} else {
+				panic(r)
+			}
+		}
+	}()
 
 	ctx = withValue(ctx, &Tx{tx: tx, fns: a.fns})
 	if err := fn(ctx); err != nil {
-		return err
+		return errors.Join(tx.Rollback(), err)
 	}
 
 	return tx.Commit()
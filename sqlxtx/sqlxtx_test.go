@@ -6,8 +6,10 @@ import (
 	"errors"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/alextanhongpin/core/storage/pg/pgtest"
+	"github.com/alextanhongpin/dbtx"
 	"github.com/alextanhongpin/dbtx/sqlxtx"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
@@ -19,7 +21,7 @@ var ctx = context.Background()
 var ErrRollback = errors.New("intentional rollback")
 
 func TestMain(m *testing.M) {
-	stop := pgtest.InitDB(pgtest.Image(postgresVersion), pgtest.Hook(migrate))
+	stop := pgtest.Init(pgtest.Image(postgresVersion), pgtest.Hook(migrate))
 	code := m.Run()
 	stop()
 	os.Exit(code)
@@ -77,6 +79,112 @@ func TestRollback(t *testing.T) {
 	assert.Equal(0, n)
 }
 
+func TestRollbackError(t *testing.T) {
+	db := pgtest.DB(t)
+	dbx := sqlx.NewDb(db, "postgres")
+	atm := sqlxtx.New(dbx)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+		// Cancelling the context rolls back the transaction, so the subsequent
+		// rollback fails.
+		cancel()
+		time.Sleep(50 * time.Millisecond)
+
+		return ErrRollback
+	})
+
+	assert := assert.New(t)
+	assert.ErrorIs(err, ErrRollback)
+	assert.ErrorIs(err, sql.ErrTxDone)
+}
+
+func TestNamed(t *testing.T) {
+	db := pgtest.DB(t)
+	dbx := sqlx.NewDb(db, "postgres")
+	atm := sqlxtx.New(dbx)
+
+	type Number struct {
+		N int `db:"n"`
+	}
+
+	assert := assert.New(t)
+
+	err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+		_, err := sqlxtx.NamedExec(txCtx, atm, `insert into numbers (n) values (:n)`, Number{N: 42})
+		if err != nil {
+			return err
+		}
+
+		rows, err := sqlxtx.NamedQuery(txCtx, atm, `select n from numbers where n = :n`, Number{N: 42})
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var ns []Number
+		for rows.Next() {
+			var n Number
+			if err := rows.StructScan(&n); err != nil {
+				return err
+			}
+			ns = append(ns, n)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		assert.Equal([]Number{{N: 42}}, ns)
+
+		return ErrRollback
+	})
+	assert.ErrorIs(err, ErrRollback)
+}
+
+func TestGetSelect(t *testing.T) {
+	db := pgtest.DB(t)
+	dbx := sqlx.NewDb(db, "postgres")
+	atm := sqlxtx.New(dbx)
+
+	assert := assert.New(t)
+
+	err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+		_, err := atm.Tx(txCtx).ExecContext(txCtx, `insert into numbers (n) values (1), (2)`)
+		if err != nil {
+			return err
+		}
+
+		var count int
+		if err := sqlxtx.Get(txCtx, atm, &count, `select count(*) from numbers`); err != nil {
+			return err
+		}
+		assert.Equal(2, count)
+
+		var ns []int
+		if err := sqlxtx.Select(txCtx, atm, &ns, `select n from numbers order by n`); err != nil {
+			return err
+		}
+		assert.Equal([]int{1, 2}, ns)
+
+		return ErrRollback
+	})
+	assert.ErrorIs(err, ErrRollback)
+}
+
+func TestErrNotTransaction(t *testing.T) {
+	db := pgtest.DB(t)
+	dbx := sqlx.NewDb(db, "postgres")
+	atm := sqlxtx.New(dbx)
+
+	defer func() {
+		err, _ := recover().(error)
+		assert.ErrorIs(t, err, dbtx.ErrNotTransaction)
+	}()
+
+	atm.Tx(ctx)
+}
+
 func migrate(db *sql.DB) error {
 	_, err := db.Exec(`create table numbers(n int);`)
 	return err
@@ -0,0 +1,158 @@
+package dbtx
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TxStats represents the statistics of a transaction.
+type TxStats struct {
+	// Queries is the number of queries executed in the transaction.
+	Queries int
+	// QueryDuration is the total duration of the queries.
+	QueryDuration time.Duration
+	// CommitDuration is the duration of the commit. It is only available
+	// after the transaction commits, e.g. in OnCommit.
+	CommitDuration time.Duration
+	// Savepoints is the number of SAVEPOINT statements executed in the
+	// transaction. Nested RunInTx reuses the parent transaction, and does not
+	// create savepoints.
+	Savepoints int
+}
+
+// StatsFromContext returns a copy of the statistics of the transaction in the
+// context.
+// Returns false if the context does not contain a transaction, or if the
+// statistics is not enabled with WithStats.
+func StatsFromContext(ctx context.Context) (*TxStats, bool) {
+	tx, ok := value(ctx)
+	if !ok || tx.stats == nil {
+		return nil, false
+	}
+
+	return tx.stats.snapshot(), true
+}
+
+// RunInTxStats is similar to RunInTx, but returns a copy of the statistics
+// of the transaction after it ends, including when it is rolled back.
+// The statistics is nil if it is not enabled with WithStats.
+// If the context already contains a transaction, the statistics of the
+// parent transaction so far is returned.
+func RunInTxStats(ctx context.Context, a runner, fn func(context.Context) error) (*TxStats, error) {
+	var tx *Tx
+	err := a.RunInTx(ctx, func(txCtx context.Context) error {
+		tx, _ = value(txCtx)
+
+		return fn(txCtx)
+	})
+	if tx == nil || tx.stats == nil {
+		return nil, err
+	}
+
+	return tx.stats.snapshot(), err
+}
+
+type stats struct {
+	mu sync.Mutex
+	TxStats
+}
+
+func (s *stats) snapshot() *TxStats {
+	s.mu.Lock()
+	txStats := s.TxStats
+	s.mu.Unlock()
+
+	return &txStats
+}
+
+func (s *stats) query(query string, start time.Time) {
+	d := time.Since(start)
+
+	s.mu.Lock()
+	s.Queries++
+	s.QueryDuration += d
+	if isSavepoint(query) {
+		s.Savepoints++
+	}
+	s.mu.Unlock()
+}
+
+func isSavepoint(query string) bool {
+	query = strings.TrimSpace(query)
+	n := len("SAVEPOINT")
+
+	return len(query) >= n && strings.EqualFold(query[:n], "SAVEPOINT")
+}
+
+func (s *stats) commit(d time.Duration) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.CommitDuration = d
+	s.mu.Unlock()
+}
+
+func (s *stats) wrap(dbtx DBTX) DBTX {
+	return &statsRecorder{dbtx: dbtx, s: s}
+}
+
+var _ DBTX = (*statsRecorder)(nil)
+
+// statsRecorder records the number and duration of the queries.
+type statsRecorder struct {
+	dbtx DBTX
+	s    *stats
+}
+
+func (r *statsRecorder) Exec(query string, args ...any) (sql.Result, error) {
+	defer r.s.query(query, time.Now())
+
+	return r.dbtx.Exec(query, args...)
+}
+
+func (r *statsRecorder) Prepare(query string) (*sql.Stmt, error) {
+	defer r.s.query(query, time.Now())
+
+	return r.dbtx.Prepare(query)
+}
+
+func (r *statsRecorder) Query(query string, args ...any) (*sql.Rows, error) {
+	defer r.s.query(query, time.Now())
+
+	return r.dbtx.Query(query, args...)
+}
+
+func (r *statsRecorder) QueryRow(query string, args ...any) *sql.Row {
+	defer r.s.query(query, time.Now())
+
+	return r.dbtx.QueryRow(query, args...)
+}
+
+func (r *statsRecorder) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	defer r.s.query(query, time.Now())
+
+	return r.dbtx.ExecContext(ctx, query, args...)
+}
+
+func (r *statsRecorder) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	defer r.s.query(query, time.Now())
+
+	return r.dbtx.PrepareContext(ctx, query)
+}
+
+func (r *statsRecorder) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	defer r.s.query(query, time.Now())
+
+	return r.dbtx.QueryContext(ctx, query, args...)
+}
+
+func (r *statsRecorder) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	defer r.s.query(query, time.Now())
+
+	return r.dbtx.QueryRowContext(ctx, query, args...)
+}
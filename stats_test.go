@@ -0,0 +1,79 @@
+package dbtx_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alextanhongpin/core/storage/pg/pgtest"
+	"github.com/alextanhongpin/dbtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("enabled", func(t *testing.T) {
+		atm := dbtx.NewWithOptions(pgtest.DB(t), dbtx.WithStats())
+		repo := newNumberRepo(atm)
+
+		is := assert.New(t)
+
+		var stats *dbtx.TxStats
+		err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+			insertRow(t, repo, txCtx, 40)
+
+			_, err := atm.Tx(txCtx).ExecContext(txCtx, `savepoint sp`)
+			is.Nil(err)
+
+			s, ok := dbtx.StatsFromContext(txCtx)
+			is.True(ok)
+			is.Equal(3, s.Queries)
+			is.Equal(1, s.Savepoints)
+			is.Greater(s.QueryDuration, time.Duration(0))
+
+			dbtx.OnCommit(txCtx, func() {
+				stats, _ = dbtx.StatsFromContext(txCtx)
+			})
+
+			return nil
+		})
+		is.Nil(err)
+		is.Equal(3, stats.Queries)
+		is.Greater(stats.CommitDuration, time.Duration(0))
+	})
+
+	t.Run("after tx", func(t *testing.T) {
+		atm := dbtx.NewWithOptions(pgtest.DB(t), dbtx.WithStats())
+
+		is := assert.New(t)
+		stats, err := dbtx.RunInTxStats(ctx, atm, func(txCtx context.Context) error {
+			_, err := atm.Tx(txCtx).ExecContext(txCtx, `select 1`)
+			return err
+		})
+		is.Nil(err)
+		is.Equal(1, stats.Queries)
+		is.Greater(stats.CommitDuration, time.Duration(0))
+
+		stats, err = dbtx.RunInTxStats(ctx, atm, func(txCtx context.Context) error {
+			_, err := atm.Tx(txCtx).ExecContext(txCtx, `select 1`)
+			is.Nil(err)
+
+			return ErrRollback
+		})
+		is.ErrorIs(err, ErrRollback)
+		is.Equal(1, stats.Queries)
+		is.Zero(stats.CommitDuration)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		atm := dbtx.New(pgtest.DB(t))
+		err := atm.RunInTx(ctx, func(txCtx context.Context) error {
+			_, ok := dbtx.StatsFromContext(txCtx)
+			assert.False(t, ok)
+
+			return nil
+		})
+		assert.Nil(t, err)
+	})
+}
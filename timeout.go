@@ -0,0 +1,247 @@
+package dbtx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrStatementTimeout = errors.New("dbtx: statement timeout")
+
+// queryCanceled is the postgres error code when the statement is cancelled,
+// e.g. when the statement_timeout is exceeded.
+const queryCanceled = "57014"
+
+// WithStatementTimeout limits the duration of each statement executed with
+// the context methods.
+// Within a transaction context, the statement_timeout is set with SET LOCAL
+// before the first statement of the transaction. SET LOCAL only applies to
+// the current transaction, so the transaction context must be passed,
+// otherwise the context deadline is used instead.
+// For QueryContext and QueryRowContext outside a transaction, the deadline
+// covers reading the rows, and is released when the rows are closed.
+// ErrStatementTimeout is returned when the timeout is exceeded. The errors
+// returned by Scan and Rows.Err cannot be wrapped, so they are either the
+// postgres query_canceled error or context.DeadlineExceeded.
+func WithStatementTimeout(d time.Duration) func(DBTX) DBTX {
+	return func(dbtx DBTX) DBTX {
+		return &statementTimeout{dbtx: dbtx, d: d}
+	}
+}
+
+var _ DBTX = (*statementTimeout)(nil)
+
+type statementTimeout struct {
+	dbtx DBTX
+	d    time.Duration
+}
+
+func (s *statementTimeout) Exec(query string, args ...any) (sql.Result, error) {
+	return s.dbtx.Exec(query, args...)
+}
+
+func (s *statementTimeout) Prepare(query string) (*sql.Stmt, error) {
+	return s.dbtx.Prepare(query)
+}
+
+func (s *statementTimeout) Query(query string, args ...any) (*sql.Rows, error) {
+	return s.dbtx.Query(query, args...)
+}
+
+func (s *statementTimeout) QueryRow(query string, args ...any) *sql.Row {
+	return s.dbtx.QueryRow(query, args...)
+}
+
+func (s *statementTimeout) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if IsTx(ctx) {
+		if err := s.setLocal(ctx); err != nil {
+			return nil, err
+		}
+
+		res, err := s.dbtx.ExecContext(ctx, query, args...)
+		return res, s.error(ctx, err)
+	}
+
+	ctx, cancel := context.WithTimeoutCause(ctx, s.d, ErrStatementTimeout)
+	defer cancel()
+
+	res, err := s.dbtx.ExecContext(ctx, query, args...)
+	return res, s.error(ctx, err)
+}
+
+func (s *statementTimeout) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return s.dbtx.PrepareContext(ctx, query)
+}
+
+func (s *statementTimeout) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if IsTx(ctx) {
+		if err := s.setLocal(ctx); err != nil {
+			return nil, err
+		}
+
+		rows, err := s.dbtx.QueryContext(ctx, query, args...)
+		return rows, s.error(ctx, err)
+	}
+
+	rctx := newRowsContext(ctx, s.d)
+	rows, err := s.dbtx.QueryContext(rctx, query, args...)
+	if err != nil {
+		rctx.cancel()
+
+		return nil, s.error(rctx, err)
+	}
+	rctx.returned()
+
+	return rows, nil
+}
+
+func (s *statementTimeout) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if IsTx(ctx) {
+		// *sql.Row cannot be created with an error. When setting the timeout
+		// fails, the transaction is aborted, so the statement fails too.
+		_ = s.setLocal(ctx)
+
+		return s.dbtx.QueryRowContext(ctx, query, args...)
+	}
+
+	rctx := newRowsContext(ctx, s.d)
+	row := s.dbtx.QueryRowContext(rctx, query, args...)
+	if row.Err() != nil {
+		rctx.cancel()
+	} else {
+		rctx.returned()
+	}
+
+	return row
+}
+
+// setLocal sets the statement_timeout for the transaction, unless it is
+// already set.
+func (s *statementTimeout) setLocal(ctx context.Context) error {
+	tx, _ := value(ctx)
+	if tx != nil && tx.getStatementTimeout() == s.d {
+		return nil
+	}
+
+	// SET LOCAL does not accept parameters, use set_config instead.
+	_, err := s.dbtx.ExecContext(ctx, `SELECT set_config('statement_timeout', $1, true)`, fmt.Sprintf("%dms", max(s.d.Milliseconds(), 1)))
+	if err != nil {
+		return err
+	}
+
+	if tx != nil {
+		tx.setStatementTimeout(s.d)
+	}
+
+	return nil
+}
+
+func (s *statementTimeout) error(ctx context.Context, err error) error {
+	if err == nil || errors.Is(err, ErrStatementTimeout) {
+		return err
+	}
+
+	var se interface{ SQLState() string }
+	if errors.As(err, &se) && se.SQLState() == queryCanceled {
+		return fmt.Errorf("%w: %w", ErrStatementTimeout, err)
+	}
+	if errors.Is(context.Cause(ctx), ErrStatementTimeout) {
+		return fmt.Errorf("%w: %w", ErrStatementTimeout, err)
+	}
+
+	return err
+}
+
+// rowsContext is the statement timeout context that is cancelled when the
+// rows are closed, instead of when QueryContext returns, so that the rows can
+// still be read.
+//
+// *sql.Rows cannot be wrapped, but it derives a context with
+// context.WithCancel that is cancelled when the rows are closed. Since
+// rowsContext implements AfterFunc, the derived context registers with it,
+// and calls the returned stop func when it is cancelled. The contexts that
+// are derived and cancelled before QueryContext returns, e.g. to dial a new
+// connection, are ignored.
+// If the context is never derived, it is released after the timeout.
+type rowsContext struct {
+	context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeDone func()
+
+	mu       sync.Mutex
+	derived  int
+	finished bool
+}
+
+func newRowsContext(ctx context.Context, d time.Duration) *rowsContext {
+	ctx, cancel := context.WithTimeoutCause(ctx, d, ErrStatementTimeout)
+	c := &rowsContext{
+		Context: ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	// A separate Done channel prevents context.WithCancel from registering
+	// with the embedded context directly.
+	c.closeDone = sync.OnceFunc(func() {
+		close(c.done)
+	})
+	context.AfterFunc(ctx, c.closeDone)
+
+	return c
+}
+
+func (c *rowsContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *rowsContext) Err() error {
+	select {
+	case <-c.done:
+		return c.Context.Err()
+	default:
+		return nil
+	}
+}
+
+func (c *rowsContext) AfterFunc(fn func()) func() bool {
+	c.mu.Lock()
+	c.derived++
+	c.mu.Unlock()
+
+	stop := context.AfterFunc(c.Context, func() {
+		// Done must be closed before fn checks Err.
+		c.closeDone()
+		fn()
+	})
+
+	var once sync.Once
+	return func() bool {
+		stopped := stop()
+		once.Do(c.release)
+
+		return stopped
+	}
+}
+
+// returned marks that QueryContext has returned, so that the context is
+// cancelled once the remaining derived contexts, i.e. the rows, are released.
+func (c *rowsContext) returned() {
+	c.mu.Lock()
+	c.finished = true
+	c.mu.Unlock()
+}
+
+func (c *rowsContext) release() {
+	c.mu.Lock()
+	c.derived--
+	done := c.finished && c.derived == 0
+	c.mu.Unlock()
+
+	if done {
+		c.cancel()
+	}
+}
@@ -0,0 +1,36 @@
+// Package unitofwork defines the unit of work interface that is implemented by
+// all the drivers, so that the application code does not depend on a specific
+// driver.
+//
+// The drivers in separate modules, such as sqlxtx and buntx, satisfy the
+// interface with their own DBTX type:
+//
+//	var _ unitofwork.Atomic[sqlxtx.DBTX] = sqlxtx.New(db)
+//
+// The package has no dependencies, so that the drivers can share its errors.
+package unitofwork
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotTransaction is returned by all the drivers when a transaction is
+// required, but the context does not contain one.
+var ErrNotTransaction = errors.New("dbtx: underlying type is not a transaction")
+
+// Atomic represents the database atomic operations in a transaction.
+// T is the DBTX type of the driver, e.g. dbtx.DBTX, sqlxtx.DBTX or
+// buntx.DBTX.
+type Atomic[T any] interface {
+	// DB returns the DBTX that is not in a transaction.
+	DB() T
+	// DBTx returns the DBTX from the context if it contains a transaction,
+	// otherwise the DBTX from DB.
+	DBTx(ctx context.Context) T
+	// Tx returns the DBTX from the context. Panics if the context does not
+	// contain a transaction.
+	Tx(ctx context.Context) T
+	// RunInTx runs the fn in a transaction.
+	RunInTx(ctx context.Context, fn func(context.Context) error) error
+}